@@ -2,8 +2,12 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
 	"syscall"
@@ -12,12 +16,13 @@ import (
 	"trustpin_integration/internal/adapters/trustpin"
 	"trustpin_integration/internal/application"
 	"trustpin_integration/internal/config"
+	"trustpin_integration/internal/domain"
 	"trustpin_integration/internal/infrastructure/idempotency"
 	"trustpin_integration/internal/infrastructure/jwt"
 	"trustpin_integration/internal/infrastructure/memory"
 	"trustpin_integration/internal/infrastructure/postgres"
 	"trustpin_integration/internal/infrastructure/redis"
-	"trustpin_integration/internal/domain"
+	"trustpin_integration/internal/infrastructure/secrets"
 	"trustpin_integration/internal/middleware"
 	"trustpin_integration/internal/transport/http"
 )
@@ -53,33 +58,78 @@ func main() {
 		logger.Error("jwt_validator", "error", err)
 		os.Exit(1)
 	}
-	issuer, err := jwt.NewIssuer(cfg.JWTPrivateKeyPEM, cfg.JWTIssuer, cfg.JWTAudience, 15*time.Minute)
+	issuer, err := jwt.NewIssuer(cfg.JWTPrivateKeyPEM, cfg.JWTIssuer, cfg.JWTAudience, cfg.TokenTTL)
 	if err != nil {
 		logger.Error("jwt_issuer", "error", err)
 		os.Exit(1)
 	}
 
+	totpKey, err := base64.StdEncoding.DecodeString(cfg.TOTPEncryptionKey)
+	if err != nil {
+		logger.Error("totp_encryption_key", "error", err)
+		os.Exit(1)
+	}
+	if len(totpKey) == 0 {
+		// Secrets sealed with a throwaway key are unreadable after a restart,
+		// which is only acceptable for local runs.
+		logger.Warn("totp_encryption_key", "message", "TOTP_ENCRYPTION_KEY not set, using an ephemeral key")
+		totpKey = make([]byte, 32)
+		if _, err := rand.Read(totpKey); err != nil {
+			logger.Error("totp_encryption_key", "error", err)
+			os.Exit(1)
+		}
+	}
+	totpCipher, err := secrets.NewAESGCM(totpKey)
+	if err != nil {
+		logger.Error("totp_encryption_key", "error", err)
+		os.Exit(1)
+	}
+
 	trustpinClient := trustpin.NewClient(cfg.TrustPinBaseURL, cfg.TrustPinAPIKey, cfg.HTTPTimeout, trustpin.RetryConfig{Max: cfg.RetryMax, Backoff: cfg.RetryBackoff})
-	trustpinAdapter := trustpin.NewAdapter(trustpinClient)
+	trustpinClient.Log = logger
+	trustpinAdapter := trustpin.NewAdapter(trustpinClient, trustpin.Versions{Default: cfg.TrustPinAPIVersion, ByTenant: cfg.TrustPinTenantVersions})
+	discoverCtx, cancelDiscover := context.WithTimeout(context.Background(), cfg.HTTPTimeout)
+	if err := trustpinAdapter.Discover(discoverCtx); err != nil {
+		logger.Warn("trustpin_discovery", "error", err)
+	}
+	cancelDiscover()
+	providers := application.NewProviderRegistry(trustpinAdapter)
 
 	var (
-		users     application.UserRepository
-		sessions  application.SessionRepository
-		devices   application.DeviceRepository
+		users      application.UserRepository
+		sessions   application.SessionRepository
+		devices    application.DeviceRepository
 		challenges application.ChallengeRepository
 		nonceStore application.NonceStore
 		idemStore  application.IdempotencyStore
+		txManager  application.TxManager
+		outbox     application.OutboxStore
+		counters   application.CounterStore
+		txns       application.MFATransactionRepository
+		recovery   application.RecoveryCodeRepository
+		audit      application.AuditRepository
+		relay      application.ChallengeEventRelay
+		policies   application.TenantPolicyRepository
+		history    application.ChallengeHistoryRepository
 	)
 
 	if cfg.DBDSN == "" || cfg.RedisAddr == "" {
 		memUsers := memory.NewUserRepo()
-		memUsers.Seed(&domain.User{ID: "demo-user", TenantID: "demo-tenant", Username: "demo", Status: "ACTIVE", CreatedAt: time.Now()})
+		memUsers.Seed(&domain.User{ID: "demo-user", TenantID: "demo-tenant", Username: "demo", Status: "ACTIVE", Roles: []string{domain.RoleAdmin}, CreatedAt: time.Now()})
 		users = memUsers
 		sessions = memory.NewSessionRepo()
 		devices = memory.NewDeviceRepo()
 		challenges = memory.NewChallengeRepo()
 		nonceStore = memory.NewNonceStore()
 		idemStore = memory.NewIdempotencyStore()
+		txManager = memory.NewTxManager()
+		outbox = memory.NewOutboxStore()
+		counters = memory.NewCounterStore()
+		txns = memory.NewMFATransactionRepo()
+		recovery = memory.NewRecoveryCodeRepo()
+		audit = memory.NewAuditRepo()
+		policies = memory.NewTenantPolicyRepo()
+		history = memory.NewChallengeHistoryRepo()
 	} else {
 		users = &postgres.UserRepo{}
 		sessions = &postgres.SessionRepo{}
@@ -87,12 +137,50 @@ func main() {
 		challenges = &postgres.ChallengeRepo{}
 		nonceStore = &redis.NonceStore{}
 		idemStore = &idempotency.Store{}
+		txManager = &postgres.TxManager{}
+		outbox = &postgres.OutboxStore{}
+		counters = &redis.CounterStore{}
+		txns = &postgres.MFATransactionRepo{}
+		recovery = &postgres.RecoveryCodeRepo{}
+		audit = &postgres.AuditRepo{}
+		relay = &redis.ChallengeEventRelay{}
+		policies = &postgres.TenantPolicyRepo{}
+		history = &postgres.ChallengeHistoryRepo{}
 	}
 
-	authSvc := &application.AuthService{Users: users, Sessions: sessions}
-	mfaSvc := &application.MFAService{Devices: devices, Challenges: challenges, NonceStore: nonceStore, IdemStore: idemStore, TrustPin: trustpinAdapter}
+	policySvc := &application.PolicyService{Policies: policies, Users: users, Audit: audit, Log: logger, Providers: providers, Defaults: domain.TenantPolicy{
+		MFAActions:        cfg.MFAActions,
+		AllowedFactors:    cfg.MFAFactors,
+		MaxDevicesPerUser: cfg.MaxDevicesPerUser,
+		Providers:         cfg.MFAProviders,
+		ChallengeTTL:      cfg.ChallengeTTL,
+		NonceTTL:          cfg.NonceTTL,
+		TokenTTL:          cfg.TokenTTL,
+		IdempotencyTTL:    cfg.IdempotencyTTL,
+	}}
+	authSvc := &application.AuthService{Users: users, Sessions: sessions, Audit: audit, Log: logger, Policies: policySvc}
+	auditSvc := &application.AuditService{Audit: audit, Users: users, Signer: issuer, Log: logger}
+	dispatcher := &application.OutboxDispatcher{Store: outbox, MaxAttempts: cfg.OutboxMaxAttempts, Backoff: cfg.OutboxBackoff, Log: logger}
+	mfaSvc := &application.MFAService{Devices: devices, Challenges: challenges, Transactions: txns, RecoveryCodes: recovery, Audit: audit, NonceStore: nonceStore, IdemStore: idemStore, Providers: providers, Tx: txManager, Outbox: dispatcher, Secrets: totpCipher, TOTPIssuer: cfg.TOTPIssuer, TOTPSkew: cfg.TOTPSkew, NumberMatch: application.NumberMatchPolicy{Tenants: cfg.NumberMatchTenants, Actions: cfg.NumberMatchActions}, PairingTTL: cfg.PairingTTL, PairingLinkBase: cfg.PairingLinkBase, Log: logger}
+	providers.Register(mfaSvc.TOTPProvider())
+	mfaSvc.Counters = counters
+	mfaSvc.Events = application.NewChallengeBroker(relay)
+	mfaSvc.Policies = policySvc
+	mfaSvc.History = history
+	mfaSvc.Users = users
+	mfaSvc.Limits = challengeLimits(cfg.ChallengeLimits)
+	mfaSvc.TenantLimits = make(map[domain.TenantID]application.ChallengeLimits, len(cfg.TenantChallengeLimits))
+	for tenant, l := range cfg.TenantChallengeLimits {
+		mfaSvc.TenantLimits[domain.TenantID(tenant)] = challengeLimits(l)
+	}
+	mfaSvc.Risk, err = riskEngine(cfg.Risk)
+	if err != nil {
+		logger.Error("risk_config", "error", err)
+		os.Exit(1)
+	}
+	mfaSvc.RegisterOutboxHandlers()
 
-	server := &httptransport.Server{Auth: authSvc, MFA: mfaSvc, JWT: jwtValidator, Log: logger, Tokens: issuer}
+	server := &httptransport.Server{Auth: authSvc, MFA: mfaSvc, Audit: auditSvc, Policy: policySvc, JWT: jwtValidator, Log: logger, Tokens: issuer, WebhookSecret: cfg.WebhookSecret, TrustProxy: cfg.TrustProxy, CountryHeader: cfg.CountryHeader, RequestTimeout: cfg.RequestTimeout, StepUpMaxAge: cfg.StepUpMaxAge}
 
 	httpServer := &http.Server{
 		Addr:              ":" + cfg.Port,
@@ -100,6 +188,46 @@ func main() {
 		ReadHeaderTimeout: 5 * time.Second,
 	}
 
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go dispatcher.Run(jobsCtx, cfg.OutboxInterval)
+	go runEvery(jobsCtx, cfg.CleanupInterval, func(ctx context.Context) {
+		n, err := mfaSvc.CleanupStaleDevices(ctx, time.Now())
+		if err != nil {
+			logger.Error("stale_device_cleanup", "error", err)
+			return
+		}
+		if n > 0 {
+			logger.Info("stale_device_cleanup", "removed", n)
+		}
+	})
+
+	go runEvery(jobsCtx, cfg.ChallengeSweep, func(ctx context.Context) {
+		n, err := mfaSvc.ExpireChallenges(ctx, time.Now())
+		if err != nil {
+			logger.Error("challenge_expiry", "error", err)
+			return
+		}
+		if n > 0 {
+			logger.Info("challenge_expiry", "expired", n)
+		}
+	})
+	go runEvery(jobsCtx, cfg.AuditCheckpoint, func(ctx context.Context) {
+		n, err := auditSvc.Checkpoint(ctx, time.Now())
+		if err != nil {
+			logger.Error("audit_checkpoint", "error", err)
+			return
+		}
+		if n > 0 {
+			logger.Info("audit_checkpoint", "signed", n)
+		}
+	})
+	go func() {
+		if err := mfaSvc.Events.Run(jobsCtx); err != nil && jobsCtx.Err() == nil {
+			logger.Error("challenge_event_relay", "error", err)
+		}
+	}()
+
 	go func() {
 		logger.Info("server_start", "port", cfg.Port)
 		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -111,8 +239,82 @@ func main() {
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 	<-stop
 
+	stopJobs()
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	_ = httpServer.Shutdown(ctx)
 	logger.Info("server_shutdown")
 }
+
+// runEvery calls fn on every tick of interval until ctx is cancelled.
+func runEvery(ctx context.Context, interval time.Duration, fn func(ctx context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fn(ctx)
+		}
+	}
+}
+
+func challengeLimits(c config.ChallengeLimits) application.ChallengeLimits {
+	return application.ChallengeLimits{
+		MaxOutstandingPerUser:   c.MaxOutstandingPerUser,
+		MaxOutstandingPerDevice: c.MaxOutstandingPerDevice,
+		MaxRecentPerUser:        c.MaxRecentPerUser,
+		MaxRecentPerDevice:      c.MaxRecentPerDevice,
+		RecentWindow:            c.RecentWindow.Duration,
+		MaxConsecutiveDenials:   c.MaxConsecutiveDenials,
+		LockoutBase:             c.LockoutBase.Duration,
+		LockoutMax:              c.LockoutMax.Duration,
+	}
+}
+
+// riskEngine builds the challenge risk rules that c switches on.
+func riskEngine(c config.RiskConfig) (*application.RiskEngine, error) {
+	e := &application.RiskEngine{AllowBelow: c.AllowBelow, NumberMatchAt: c.NumberMatchAt, DenyAt: c.DenyAt}
+	for _, n := range []struct {
+		label string
+		cidrs []string
+		score int
+	}{
+		{"blocked_network", c.BlockedNetworks, c.BlockedNetworkScore},
+		{"trusted_network", c.TrustedNetworks, c.TrustedNetworkScore},
+	} {
+		if len(n.cidrs) == 0 {
+			continue
+		}
+		rule := application.NetworkRule{Label: n.label, Points: n.score}
+		for _, cidr := range n.cidrs {
+			p, err := netip.ParsePrefix(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", n.label, err)
+			}
+			rule.Networks = append(rule.Networks, p.Masked())
+		}
+		e.Rules = append(e.Rules, rule)
+	}
+	if len(c.UserAgentPatterns) > 0 {
+		e.Rules = append(e.Rules, application.UserAgentRule{Patterns: c.UserAgentPatterns, Points: c.UserAgentScore})
+	}
+	if len(c.AllowedCountries) > 0 {
+		e.Rules = append(e.Rules, application.CountryRule{Allowed: c.AllowedCountries, Points: c.CountryScore})
+	}
+	if c.OffHours != "" {
+		var from, to int
+		if _, err := fmt.Sscanf(c.OffHours, "%d-%d", &from, &to); err != nil || from < 0 || from > 23 || to < 0 || to > 24 {
+			return nil, fmt.Errorf("off hours %q: want a range such as 22-6", c.OffHours)
+		}
+		e.Rules = append(e.Rules, application.TimeOfDayRule{From: from, To: to, Points: c.OffHoursScore})
+	}
+	if c.NewDeviceAge > 0 {
+		e.Rules = append(e.Rules, application.NewDeviceRule{MinAge: c.NewDeviceAge, Points: c.NewDeviceScore})
+	}
+	if c.RecentFailures > 0 {
+		e.Rules = append(e.Rules, application.RecentFailuresRule{Threshold: c.RecentFailures, Points: c.RecentFailuresScore})
+	}
+	return e, nil
+}
@@ -0,0 +1,66 @@
+// Command verify-audit checks an audit export, as returned by
+// GET /api/admin/audit/export, for gaps, reordering and modified entries,
+// and checks its signed checkpoints against the service's JWT public key
+// (JWT_PUBLIC_KEY / JWT_PUBLIC_KEY_FILE and JWT_ISSUER, as for the server).
+//
+//	verify-audit -in export.json
+//
+// It exits 0 when the chain is intact, 1 when violations were found and 2
+// when the export could not be read.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"trustpin_integration/internal/application"
+	"trustpin_integration/internal/config"
+	"trustpin_integration/internal/infrastructure/jwt"
+)
+
+func main() {
+	in := flag.String("in", "-", "audit export to verify, - for stdin")
+	flag.Parse()
+
+	cfg := config.Load()
+	verifier, err := jwt.NewCheckpointVerifier(cfg.JWTPublicKeyPEM, cfg.JWTIssuer)
+	if err != nil {
+		fail("public key: %v", err)
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "-" {
+		f, err := os.Open(*in)
+		if err != nil {
+			fail("%v", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	var exp application.AuditExport
+	if err := json.NewDecoder(r).Decode(&exp); err != nil {
+		fail("decode export: %v", err)
+	}
+
+	violations := application.VerifyAuditExport(&exp, verifier)
+	for _, v := range violations {
+		fmt.Println(v)
+	}
+	if len(violations) > 0 {
+		fmt.Printf("tenant %s: %d violation(s) in %d entries\n", exp.TenantID, len(violations), len(exp.Entries))
+		os.Exit(1)
+	}
+	var head int64
+	if n := len(exp.Entries); n > 0 {
+		head = exp.Entries[n-1].Seq
+	}
+	fmt.Printf("tenant %s: ok, %d entries, head seq %d, %d checkpoint(s)\n", exp.TenantID, len(exp.Entries), head, len(exp.Checkpoints))
+}
+
+func fail(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "verify-audit: "+format+"\n", args...)
+	os.Exit(2)
+}
@@ -2,19 +2,35 @@ package trustpin
 
 import (
 	"context"
-	"fmt"
+	"sync"
 
 	"trustpin_integration/internal/application"
+	"trustpin_integration/internal/domain"
 )
 
+// Adapter serves each tenant through the Trustpin API version it is
+// configured for, so tenants can move to a new version one at a time.
 type Adapter struct {
-	client *Client
+	client   *Client
+	versions Versions
+
+	mu sync.RWMutex
+	// served holds the versions Trustpin reported by Discover; nil until
+	// then, when configured versions are used unchecked.
+	served map[string]bool
 }
 
-func NewAdapter(client *Client) *Adapter {
-	return &Adapter{client: client}
+func NewAdapter(client *Client, versions Versions) *Adapter {
+	return &Adapter{client: client, versions: versions}
 }
 
+// ProviderName is the name the adapter is registered under.
+const ProviderName = "trustpin"
+
+func (a *Adapter) Name() string { return ProviderName }
+
+func (a *Adapter) DeviceType() string { return domain.DeviceTypeTrustPin }
+
 type enrollmentInitRequest struct {
 	TenantID string `json:"tenant_id"`
 	UserID   string `json:"user_id"`
@@ -46,12 +62,8 @@ func (a *Adapter) Enroll(ctx context.Context, req application.TrustPinEnrollRequ
 		TenantID: req.TenantID,
 		UserID:   req.UserID,
 	}
-	var out struct {
-		EnrollmentID string `json:"enrollment_id"`
-		PairingCode  string `json:"pairing_code"`
-		ExpiresAt    string `json:"expires_at"`
-	}
-	if err := a.client.do(ctx, "POST", "/v1/enrollments/init", req.TenantID, payload, &out); err != nil {
+	var out enrollmentInitResponse
+	if err := a.client.do(ctx, "POST", a.api(req.TenantID).enrollmentInit, req.TenantID, payload, &out); err != nil {
 		return nil, err
 	}
 	return &application.TrustPinEnrollResponse{EnrollmentID: out.EnrollmentID, PairingCode: out.PairingCode, ExpiresAt: out.ExpiresAt}, nil
@@ -63,11 +75,8 @@ func (a *Adapter) Activate(ctx context.Context, req application.TrustPinActivate
 		PublicKey:   req.PublicKey,
 		Label:       req.Label,
 	}
-	var out struct {
-		DeviceID string `json:"device_id"`
-		State    string `json:"state"`
-	}
-	if err := a.client.do(ctx, "POST", "/v1/devices/activate", req.TenantID, payload, &out); err != nil {
+	var out deviceActivateResponse
+	if err := a.client.do(ctx, "POST", a.api(req.TenantID).deviceActivate, req.TenantID, payload, &out); err != nil {
 		return nil, err
 	}
 	return &application.TrustPinActivateResponse{DeviceID: out.DeviceID, State: out.State}, nil
@@ -81,13 +90,8 @@ func (a *Adapter) CreateChallenge(ctx context.Context, req application.TrustPinC
 		Action:   req.Action,
 		Context:  req.Context,
 	}
-	var out struct {
-		ChallengeID string `json:"challenge_id"`
-		State       string `json:"state"`
-		IssuedAt    string `json:"issued_at"`
-		ExpiresAt   string `json:"expires_at"`
-	}
-	if err := a.client.do(ctx, "POST", "/v1/auth/challenges/init", req.TenantID, payload, &out); err != nil {
+	var out challengeInitResponse
+	if err := a.client.do(ctx, "POST", a.api(req.TenantID).challengeInit, req.TenantID, payload, &out); err != nil {
 		return nil, err
 	}
 	return &application.TrustPinChallengeResponse{ChallengeID: out.ChallengeID, State: out.State, IssuedAt: out.IssuedAt, ExpiresAt: out.ExpiresAt}, nil
@@ -95,7 +99,7 @@ func (a *Adapter) CreateChallenge(ctx context.Context, req application.TrustPinC
 
 func (a *Adapter) Approve(ctx context.Context, req application.TrustPinApproveRequest) (*application.TrustPinApproveResponse, error) {
 	if req.ChallengeID == "" {
-		return nil, fmt.Errorf("missing_challenge_id")
+		return nil, application.InvalidInput("missing_challenge_id")
 	}
 	payload := challengeDecisionRequest{
 		DeviceID:  req.DeviceID,
@@ -103,8 +107,22 @@ func (a *Adapter) Approve(ctx context.Context, req application.TrustPinApproveRe
 		Payload:   req.Payload,
 		TOTPCode:  req.TOTPCode,
 	}
-	if err := a.client.do(ctx, "POST", "/v1/auth/challenges/"+req.ChallengeID+"/approve", req.TenantID, payload, nil); err != nil {
+	if err := a.client.do(ctx, "POST", a.api(req.TenantID).approve(req.ChallengeID), req.TenantID, payload, nil); err != nil {
 		return nil, err
 	}
 	return &application.TrustPinApproveResponse{ChallengeID: req.ChallengeID, Status: "APPROVED"}, nil
 }
+
+func (a *Adapter) RevokeDevice(ctx context.Context, req application.TrustPinRevokeRequest) error {
+	if req.DeviceID == "" {
+		return application.InvalidInput("missing_device_id")
+	}
+	return a.client.do(ctx, "DELETE", a.api(req.TenantID).device(req.DeviceID), req.TenantID, nil, nil)
+}
+
+func (a *Adapter) CancelEnrollment(ctx context.Context, req application.TrustPinCancelEnrollmentRequest) error {
+	if req.EnrollmentID == "" {
+		return application.InvalidInput("missing_enrollment_id")
+	}
+	return a.client.do(ctx, "DELETE", a.api(req.TenantID).enrollment(req.EnrollmentID), req.TenantID, nil, nil)
+}
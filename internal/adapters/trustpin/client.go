@@ -6,84 +6,178 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"log/slog"
 	"net/http"
 	"time"
+
+	"trustpin_integration/internal/application"
+	"trustpin_integration/internal/tracecontext"
 )
 
 type Client struct {
 	baseURL string
 	apiKey  string
 	client  *http.Client
+	timeout time.Duration
 	retry   RetryConfig
+	// Log receives every attempt and the responses rejected by
+	// validation; nil means slog.Default.
+	Log *slog.Logger
 }
 
 type RetryConfig struct {
-	Max       int
-	Backoff   time.Duration
-}
-
-type Error struct {
-	Status int
-	Body   []byte
-}
-
-func (e *Error) Error() string {
-	return "trustpin_error"
+	Max     int
+	Backoff time.Duration
 }
 
+// NewClient returns a client for the Trustpin API at baseURL. timeout bounds
+// each attempt of a call whose context has no deadline; under a deadline the
+// attempts share what is left of it.
 func NewClient(baseURL, apiKey string, timeout time.Duration, retry RetryConfig) *Client {
 	return &Client{
 		baseURL: baseURL,
 		apiKey:  apiKey,
-		client:  &http.Client{Timeout: timeout},
+		client:  &http.Client{},
+		timeout: timeout,
 		retry:   retry,
 	}
 }
 
 func (c *Client) do(ctx context.Context, method, path, tenantID string, payload any, out any) error {
-	b, err := json.Marshal(payload)
-	if err != nil {
-		return err
-	}
-
-	url := c.baseURL + path
-	for attempt := 0; attempt <= c.retry.Max; attempt++ {
-		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(b))
+	var b []byte
+	if payload != nil {
+		var err error
+		b, err = json.Marshal(payload)
 		if err != nil {
 			return err
 		}
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("X-API-Key", c.apiKey)
-		req.Header.Set("X-Tenant-ID", tenantID)
+	}
+	// Calls made outside a request, such as by background jobs, start a
+	// trace of their own.
+	trace, ok := tracecontext.Parse(application.RequestMetaFrom(ctx).TraceParent)
+	if !ok {
+		trace = tracecontext.New()
+	}
 
-		resp, err := c.client.Do(req)
+	for attempt := 0; attempt <= c.retry.Max; attempt++ {
+		if attempt > 0 {
+			if err := sleep(ctx, c.retry.Backoff); err != nil {
+				return upstreamFailure(ctx, err)
+			}
+		}
+		timeout := c.attemptTimeout(ctx, c.retry.Max-attempt+1)
+		status, body, err := c.attempt(ctx, method, path, tenantID, b, trace.Child(), timeout, attempt+1)
 		if err != nil {
-			if attempt < c.retry.Max {
-				time.Sleep(c.retry.Backoff)
+			if attempt < c.retry.Max && ctx.Err() == nil {
 				continue
 			}
-			return err
+			return upstreamFailure(ctx, err)
 		}
-		defer resp.Body.Close()
-		body, _ := io.ReadAll(resp.Body)
 
-		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if status >= 200 && status < 300 {
 			if out == nil {
 				return nil
 			}
 			if err := json.Unmarshal(body, out); err != nil {
-				return err
+				return c.invalidResponse(ctx, method, path, "undecodable body")
+			}
+			if r, ok := out.(response); ok {
+				if problem := r.validate(); problem != "" {
+					return c.invalidResponse(ctx, method, path, problem)
+				}
 			}
 			return nil
 		}
 
-		if resp.StatusCode == http.StatusServiceUnavailable && attempt < c.retry.Max {
-			time.Sleep(c.retry.Backoff)
+		if status == http.StatusServiceUnavailable && attempt < c.retry.Max {
 			continue
 		}
 
-		return &Error{Status: resp.StatusCode, Body: body}
+		return &application.UpstreamError{Provider: ProviderName, Status: status, Body: body}
+	}
+
+	return &application.UpstreamError{Provider: ProviderName, Err: errors.New("retry_exhausted")}
+}
+
+// attempt makes one request within timeout and logs its outcome. It forwards
+// the request ID and trace, and returns the status and body of the response
+// or why none arrived.
+func (c *Client) attempt(ctx context.Context, method, path, tenantID string, payload []byte, trace tracecontext.TraceParent, timeout time.Duration, n int) (int, []byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return 0, nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
 	}
+	req.Header.Set("X-API-Key", c.apiKey)
+	req.Header.Set("X-Tenant-ID", tenantID)
+	if key, ok := application.IdempotencyKey(ctx); ok {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	rid := application.RequestMetaFrom(ctx).RequestID
+	if rid != "" {
+		req.Header.Set("X-Request-ID", rid)
+	}
+	req.Header.Set(tracecontext.Header, trace.String())
 
-	return errors.New("retry_exhausted")
+	start := time.Now()
+	log := c.logger().With("method", method, "path", path, "tenant_id", tenantID, "attempt", n, "request_id", rid, "traceparent", trace.String())
+	resp, err := c.client.Do(req)
+	if err != nil {
+		log.Warn("trustpin_attempt", "duration_ms", time.Since(start).Milliseconds(), "timeout_ms", timeout.Milliseconds(), "error", err)
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	log.Info("trustpin_attempt", "duration_ms", time.Since(start).Milliseconds(), "status", resp.StatusCode)
+	return resp.StatusCode, body, nil
+}
+
+// attemptTimeout splits what is left of ctx's deadline evenly over the
+// attempts still allowed, so a slow attempt leaves the retries time to run.
+// Without a deadline each attempt gets the client's timeout.
+func (c *Client) attemptTimeout(ctx context.Context, attemptsLeft int) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return c.timeout
+	}
+	return time.Until(deadline) / time.Duration(attemptsLeft)
+}
+
+// upstreamFailure reports a call that got no response. Running out of the
+// caller's deadline is a timeout rather than a fault at Trustpin.
+func upstreamFailure(ctx context.Context, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &application.Error{Kind: application.ErrTimeout, Code: "upstream_timeout", Entity: ProviderName, Err: err}
+	}
+	return &application.UpstreamError{Provider: ProviderName, Err: err}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// invalidResponse logs a successful response to method path that does not
+// hold what the API promises, with the request it was made for, and returns
+// the error reporting it.
+func (c *Client) invalidResponse(ctx context.Context, method, path, problem string) error {
+	c.logger().Error("trustpin_invalid_response", "method", method, "path", path, "problem", problem, "request_id", application.RequestMetaFrom(ctx).RequestID)
+	return application.InvalidResponse(ProviderName, problem)
+}
+
+func (c *Client) logger() *slog.Logger {
+	if c.Log != nil {
+		return c.Log
+	}
+	return slog.Default()
 }
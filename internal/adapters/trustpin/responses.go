@@ -0,0 +1,99 @@
+package trustpin
+
+import (
+	"fmt"
+	"time"
+
+	"trustpin_integration/internal/domain"
+)
+
+// response is a decoded Trustpin response body that can tell whether it
+// holds what the API promises. validate returns what is wrong with it, or ""
+// when nothing is.
+type response interface {
+	validate() string
+}
+
+type enrollmentInitResponse struct {
+	EnrollmentID string `json:"enrollment_id"`
+	PairingCode  string `json:"pairing_code"`
+	ExpiresAt    string `json:"expires_at"`
+}
+
+func (r *enrollmentInitResponse) validate() string {
+	return firstProblem(
+		required("enrollment_id", r.EnrollmentID),
+		required("pairing_code", r.PairingCode),
+		timestamp("expires_at", r.ExpiresAt, true),
+	)
+}
+
+type deviceActivateResponse struct {
+	DeviceID string `json:"device_id"`
+	State    string `json:"state"`
+}
+
+func (r *deviceActivateResponse) validate() string {
+	return firstProblem(
+		required("device_id", r.DeviceID),
+		oneOf("state", r.State, domain.DeviceStateActive),
+	)
+}
+
+type challengeInitResponse struct {
+	ChallengeID string `json:"challenge_id"`
+	State       string `json:"state"`
+	IssuedAt    string `json:"issued_at"`
+	ExpiresAt   string `json:"expires_at"`
+}
+
+func (r *challengeInitResponse) validate() string {
+	return firstProblem(
+		required("challenge_id", r.ChallengeID),
+		oneOf("state", r.State, domain.ChallengeStatePushSent, domain.ChallengeStateCodeRequired),
+		timestamp("issued_at", r.IssuedAt, false),
+		timestamp("expires_at", r.ExpiresAt, true),
+	)
+}
+
+func firstProblem(problems ...string) string {
+	for _, p := range problems {
+		if p != "" {
+			return p
+		}
+	}
+	return ""
+}
+
+func required(field, v string) string {
+	if v == "" {
+		return "missing " + field
+	}
+	return ""
+}
+
+func oneOf(field, v string, known ...string) string {
+	if v == "" {
+		return "missing " + field
+	}
+	for _, k := range known {
+		if v == k {
+			return ""
+		}
+	}
+	return fmt.Sprintf("unknown %s %q", field, v)
+}
+
+// timestamp checks an RFC 3339 field; an absent optional one passes.
+func timestamp(field, v string, mandatory bool) string {
+	if v == "" {
+		if mandatory {
+			return "missing " + field
+		}
+		return ""
+	}
+	if _, err := time.Parse(time.RFC3339, v); err != nil {
+		return "invalid " + field
+	}
+	return ""
+}
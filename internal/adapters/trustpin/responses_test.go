@@ -0,0 +1,46 @@
+package trustpin
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestResponseValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		resp response
+		body string
+		want string
+	}{
+		{"enrollment ok", &enrollmentInitResponse{}, `{"enrollment_id":"e","pairing_code":"P","expires_at":"2024-01-01T00:00:00Z"}`, ""},
+		{"enrollment without id", &enrollmentInitResponse{}, `{"pairing_code":"P","expires_at":"2024-01-01T00:00:00Z"}`, "missing enrollment_id"},
+		{"enrollment without code", &enrollmentInitResponse{}, `{"enrollment_id":"e","expires_at":"2024-01-01T00:00:00Z"}`, "missing pairing_code"},
+		{"enrollment without expiry", &enrollmentInitResponse{}, `{"enrollment_id":"e","pairing_code":"P"}`, "missing expires_at"},
+		{"enrollment bad expiry", &enrollmentInitResponse{}, `{"enrollment_id":"e","pairing_code":"P","expires_at":"tomorrow"}`, "invalid expires_at"},
+
+		{"activate ok", &deviceActivateResponse{}, `{"device_id":"d","state":"ACTIVE"}`, ""},
+		{"activate without device", &deviceActivateResponse{}, `{"state":"ACTIVE"}`, "missing device_id"},
+		{"activate without state", &deviceActivateResponse{}, `{"device_id":"d"}`, "missing state"},
+		{"activate unknown state", &deviceActivateResponse{}, `{"device_id":"d","state":"PENDING"}`, `unknown state "PENDING"`},
+
+		{"challenge ok", &challengeInitResponse{}, `{"challenge_id":"c","state":"PUSH_SENT","issued_at":"2024-01-01T00:00:00Z","expires_at":"2024-01-01T00:02:00Z"}`, ""},
+		{"challenge code required", &challengeInitResponse{}, `{"challenge_id":"c","state":"CODE_REQUIRED","expires_at":"2024-01-01T00:02:00Z"}`, ""},
+		{"challenge without id", &challengeInitResponse{}, `{"state":"PUSH_SENT","expires_at":"2024-01-01T00:02:00Z"}`, "missing challenge_id"},
+		{"challenge unknown state", &challengeInitResponse{}, `{"challenge_id":"c","state":"APPROVED","expires_at":"2024-01-01T00:02:00Z"}`, `unknown state "APPROVED"`},
+		{"challenge bad issued_at", &challengeInitResponse{}, `{"challenge_id":"c","state":"PUSH_SENT","issued_at":"now","expires_at":"2024-01-01T00:02:00Z"}`, "invalid issued_at"},
+		{"challenge without expiry", &challengeInitResponse{}, `{"challenge_id":"c","state":"PUSH_SENT"}`, "missing expires_at"},
+
+		{"capabilities ok", &capabilitiesResponse{}, `{"versions":["v1","v2"]}`, ""},
+		{"capabilities empty", &capabilitiesResponse{}, `{"versions":[]}`, "missing versions"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := json.Unmarshal([]byte(tt.body), tt.resp); err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.resp.validate(); got != tt.want {
+				t.Errorf("validate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
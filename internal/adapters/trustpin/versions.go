@@ -0,0 +1,136 @@
+package trustpin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"trustpin_integration/internal/application"
+)
+
+// API versions the adapter speaks.
+const (
+	V1 = "v1"
+	V2 = "v2"
+)
+
+// apiVersion locates the Trustpin operations in one version of its API.
+// Changes between versions are recorded here; the adapter methods are the
+// same for every version.
+type apiVersion struct {
+	enrollmentInit string
+	deviceActivate string
+	challengeInit  string
+	approve        func(challengeID string) string
+	device         func(deviceID string) string
+	enrollment     func(enrollmentID string) string
+}
+
+var apiVersions = map[string]apiVersion{
+	V1: {
+		enrollmentInit: "/v1/enrollments/init",
+		deviceActivate: "/v1/devices/activate",
+		challengeInit:  "/v1/auth/challenges/init",
+		approve:        func(id string) string { return "/v1/auth/challenges/" + id + "/approve" },
+		device:         func(id string) string { return "/v1/devices/" + id },
+		enrollment:     func(id string) string { return "/v1/enrollments/" + id },
+	},
+	V2: {
+		enrollmentInit: "/v2/enrollments/init",
+		deviceActivate: "/v2/devices/activate",
+		challengeInit:  "/v2/auth/challenges/init",
+		approve:        func(id string) string { return "/v2/auth/challenges/" + id + "/approve" },
+		device:         func(id string) string { return "/v2/devices/" + id },
+		enrollment:     func(id string) string { return "/v2/enrollments/" + id },
+	},
+}
+
+// capabilitiesPath is the unversioned discovery endpoint. Deployments that
+// predate it serve v1 only.
+const capabilitiesPath = "/capabilities"
+
+// Versions selects the API version each tenant is served with. Tenants not
+// listed in ByTenant use Default; an empty Default means v1.
+type Versions struct {
+	Default  string
+	ByTenant map[string]string
+}
+
+type capabilitiesResponse struct {
+	Versions []string `json:"versions"`
+}
+
+func (r *capabilitiesResponse) validate() string {
+	if len(r.Versions) == 0 {
+		return "missing versions"
+	}
+	return ""
+}
+
+// Discover asks Trustpin which API versions it serves. Tenants configured
+// for a version this adapter does not know or Trustpin does not serve are
+// moved to the default version, or to v1 when that is unavailable too, and
+// the returned error lists them. When the call itself fails the configured
+// versions stay in use unchecked.
+func (a *Adapter) Discover(ctx context.Context) error {
+	var out capabilitiesResponse
+	err := a.client.do(ctx, "GET", capabilitiesPath, "", nil, &out)
+	var up *application.UpstreamError
+	switch {
+	case errors.As(err, &up) && up.Status == http.StatusNotFound:
+		out.Versions = []string{V1}
+	case err != nil:
+		return err
+	}
+	served := make(map[string]bool, len(out.Versions))
+	for _, v := range out.Versions {
+		served[v] = true
+	}
+
+	a.mu.Lock()
+	a.served = served
+	a.mu.Unlock()
+
+	var unavailable []string
+	if v := a.versions.Default; v != "" && !a.available(v) {
+		unavailable = append(unavailable, "default="+v)
+	}
+	for tenant, v := range a.versions.ByTenant {
+		if !a.available(v) {
+			unavailable = append(unavailable, tenant+"="+v)
+		}
+	}
+	if len(unavailable) > 0 {
+		sort.Strings(unavailable)
+		return fmt.Errorf("trustpin api versions unavailable, falling back: %v", unavailable)
+	}
+	return nil
+}
+
+// Version returns the API version tenantID is served with.
+func (a *Adapter) Version(tenantID string) string {
+	if v, ok := a.versions.ByTenant[tenantID]; ok && a.available(v) {
+		return v
+	}
+	if v := a.versions.Default; v != "" && a.available(v) {
+		return v
+	}
+	return V1
+}
+
+// available reports whether v is a version the adapter knows and, once
+// discovered, Trustpin serves.
+func (a *Adapter) available(v string) bool {
+	if _, ok := apiVersions[v]; !ok {
+		return false
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.served == nil || a.served[v]
+}
+
+func (a *Adapter) api(tenantID string) apiVersion {
+	return apiVersions[a.Version(tenantID)]
+}
@@ -0,0 +1,196 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"trustpin_integration/internal/domain"
+)
+
+// auditAction names the events recorded for one operation: OK when it
+// succeeds, Failed when it returns an error. An empty OK records failures
+// only, for operations whose success is recorded as a state change.
+type auditAction struct {
+	OK     string
+	Failed string
+}
+
+var (
+	auditLogin            = auditAction{"auth.login.succeeded", "auth.login.failed"}
+	auditDeviceEnroll     = auditAction{"mfa.device.enrolled", "mfa.device.enroll_failed"}
+	auditDeviceActivate   = auditAction{"mfa.device.activated", "mfa.device.activate_failed"}
+	auditDeviceRename     = auditAction{"mfa.device.renamed", "mfa.device.rename_failed"}
+	auditDeviceRevoke     = auditAction{"mfa.device.revoked", "mfa.device.revoke_failed"}
+	auditDevicePrimary    = auditAction{"mfa.device.primary_changed", "mfa.device.primary_change_failed"}
+	auditChallengeCreate  = auditAction{"mfa.challenge.created", "mfa.challenge.create_failed"}
+	auditChallengeApprove = auditAction{"mfa.challenge.approve_submitted", "mfa.challenge.approve_failed"}
+	auditChallengeDeny    = auditAction{"", "mfa.challenge.deny_failed"}
+	auditLoginMFABegin    = auditAction{"mfa.login.started", "mfa.login.start_failed"}
+	auditLoginMFAComplete = auditAction{"mfa.login.completed", "mfa.login.complete_failed"}
+	auditStepUp           = auditAction{"mfa.step_up.granted", "mfa.step_up.failed"}
+	auditPolicyUpdate     = auditAction{"tenant.policy.updated", "tenant.policy.update_failed"}
+)
+
+const (
+	auditChallengeState = "mfa.challenge.state_changed"
+	auditDeviceDiscard  = "mfa.device.discarded"
+)
+
+// appendAudit writes one audit entry, stamped with the request metadata in
+// ctx.
+func appendAudit(ctx context.Context, repo AuditRepository, tenantID domain.TenantID, userID, eventType string, payload map[string]any) error {
+	if repo == nil {
+		return nil
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	meta := RequestMetaFrom(ctx)
+	entry := &domain.AuditLog{
+		ID:        newID(),
+		TenantID:  tenantID,
+		EventType: eventType,
+		Payload:   string(b),
+		RequestID: meta.RequestID,
+		IP:        meta.IP,
+		UserAgent: meta.UserAgent,
+		// Stores keep microseconds; hashing a finer time would not survive
+		// a round trip.
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+	if userID != "" {
+		entry.UserID = &userID
+	}
+	return repo.Append(ctx, entry)
+}
+
+// auditResult records the outcome of an operation. It runs after the
+// operation finished, so a failure to write is logged rather than returned.
+func auditResult(ctx context.Context, repo AuditRepository, log *slog.Logger, tenantID domain.TenantID, userID string, a auditAction, err error, payload map[string]any) {
+	event := a.OK
+	if err != nil {
+		event = a.Failed
+		if payload == nil {
+			payload = map[string]any{}
+		}
+		_, payload["error"] = Classify(err)
+	}
+	if event == "" {
+		return
+	}
+	if auditErr := appendAudit(ctx, repo, tenantID, userID, event, payload); auditErr != nil {
+		log.Error("audit_append", "event", event, "error", auditErr)
+	}
+}
+
+// audit appends an event to the audit log. Call it inside the transaction of
+// the change it records so the two are stored together.
+func (s *MFAService) audit(ctx context.Context, tenantID domain.TenantID, userID, eventType string, payload map[string]any) error {
+	return appendAudit(ctx, s.Audit, tenantID, userID, eventType, payload)
+}
+
+func (s *MFAService) auditResult(ctx context.Context, tenantID domain.TenantID, userID string, a auditAction, err error, payload map[string]any) {
+	auditResult(ctx, s.Audit, s.logger(), tenantID, userID, a, err, payload)
+}
+
+// AuditService answers audit log queries for tenant administrators and
+// signs the audit chains.
+type AuditService struct {
+	Audit  AuditRepository
+	Users  UserRepository
+	Signer AuditSigner
+	Log    *slog.Logger
+}
+
+// Query returns one page of the tenant's audit entries matching f. The
+// caller must be an admin or auditor of the tenant.
+func (s *AuditService) Query(ctx context.Context, tenantID domain.TenantID, callerID string, f AuditFilter, offset, limit int) ([]*domain.AuditLog, int, error) {
+	if err := s.authorize(ctx, tenantID, callerID); err != nil {
+		return nil, 0, err
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && !f.From.Before(f.To) {
+		return nil, 0, InvalidInput("invalid_time_range")
+	}
+	return s.Audit.List(ctx, tenantID, f, offset, limit)
+}
+
+// Export returns the tenant's whole audit chain and checkpoints for
+// verification. The caller must be an admin or auditor of the tenant.
+func (s *AuditService) Export(ctx context.Context, tenantID domain.TenantID, callerID string) (*AuditExport, error) {
+	if err := s.authorize(ctx, tenantID, callerID); err != nil {
+		return nil, err
+	}
+	entries, err := s.Audit.Chain(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	checkpoints, err := s.Audit.Checkpoints(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return newAuditExport(tenantID, entries, checkpoints), nil
+}
+
+// Checkpoint signs the head of every tenant's chain that grew since its last
+// checkpoint. It returns the number of checkpoints written.
+func (s *AuditService) Checkpoint(ctx context.Context, now time.Time) (int, error) {
+	heads, err := s.Audit.Heads(ctx)
+	if err != nil {
+		return 0, err
+	}
+	written := 0
+	for _, h := range heads {
+		ok, err := s.checkpoint(ctx, h, now)
+		if err != nil {
+			s.logger().Error("audit_checkpoint_failed", "tenant_id", h.TenantID, "seq", h.Seq, "error", err)
+			continue
+		}
+		if ok {
+			written++
+		}
+	}
+	return written, nil
+}
+
+// checkpoint signs head unless the tenant's last checkpoint already covers
+// it, and reports whether it wrote one.
+func (s *AuditService) checkpoint(ctx context.Context, head *domain.AuditLog, now time.Time) (bool, error) {
+	existing, err := s.Audit.Checkpoints(ctx, head.TenantID)
+	if err != nil {
+		return false, err
+	}
+	if n := len(existing); n > 0 && existing[n-1].Seq >= head.Seq {
+		return false, nil
+	}
+	cp := &domain.AuditCheckpoint{TenantID: head.TenantID, Seq: head.Seq, Hash: head.Hash, CreatedAt: now.UTC().Truncate(time.Microsecond)}
+	if cp.Signature, err = s.Signer.SignAuditCheckpoint(cp); err != nil {
+		return false, err
+	}
+	return true, s.Audit.SaveCheckpoint(ctx, cp)
+}
+
+func (s *AuditService) authorize(ctx context.Context, tenantID domain.TenantID, callerID string) error {
+	return requireRole(ctx, s.Users, tenantID, callerID, domain.RoleAdmin, domain.RoleAuditor)
+}
+
+// requireRole refuses callers that hold none of roles in the tenant.
+func requireRole(ctx context.Context, users UserRepository, tenantID domain.TenantID, callerID string, roles ...string) error {
+	caller, err := users.GetByID(ctx, tenantID, callerID)
+	if err != nil {
+		return err
+	}
+	if caller == nil || !caller.HasRole(roles...) {
+		return Forbidden("insufficient_role")
+	}
+	return nil
+}
+
+func (s *AuditService) logger() *slog.Logger {
+	if s.Log != nil {
+		return s.Log
+	}
+	return slog.Default()
+}
@@ -0,0 +1,186 @@
+package application
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"trustpin_integration/internal/domain"
+)
+
+// ChainAuditEntry links e to the tenant's current head, which is nil for the
+// tenant's first entry, by setting its Seq, PrevHash and Hash. Repositories
+// call it while holding the tenant's chain so appends are serialized.
+func ChainAuditEntry(head, e *domain.AuditLog) {
+	e.Seq, e.PrevHash = 1, ""
+	if head != nil {
+		e.Seq, e.PrevHash = head.Seq+1, head.Hash
+	}
+	e.Hash = AuditHash(e)
+}
+
+// AuditHash is the hex SHA-256 of e's content, position and PrevHash. The
+// fields are hashed as one JSON array so no two entries share an encoding.
+func AuditHash(e *domain.AuditLog) string {
+	var userID any
+	if e.UserID != nil {
+		userID = *e.UserID
+	}
+	b, _ := json.Marshal([]any{
+		string(e.TenantID),
+		strconv.FormatInt(e.Seq, 10),
+		e.PrevHash,
+		e.ID,
+		userID,
+		e.EventType,
+		e.Payload,
+		e.RequestID,
+		e.IP,
+		e.UserAgent,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditExport is a tenant's whole audit chain with its checkpoints, in the
+// form the verify-audit command reads.
+type AuditExport struct {
+	TenantID    string                  `json:"tenant_id"`
+	Entries     []AuditExportEntry      `json:"entries"`
+	Checkpoints []AuditExportCheckpoint `json:"checkpoints"`
+}
+
+type AuditExportEntry struct {
+	Seq       int64     `json:"seq"`
+	ID        string    `json:"id"`
+	UserID    *string   `json:"user_id"`
+	EventType string    `json:"event_type"`
+	Payload   string    `json:"payload"`
+	RequestID string    `json:"request_id"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+	PrevHash  string    `json:"prev_hash"`
+	Hash      string    `json:"hash"`
+}
+
+type AuditExportCheckpoint struct {
+	Seq       int64     `json:"seq"`
+	Hash      string    `json:"hash"`
+	Signature string    `json:"signature"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newAuditExport(tenantID domain.TenantID, entries []*domain.AuditLog, checkpoints []*domain.AuditCheckpoint) *AuditExport {
+	exp := &AuditExport{
+		TenantID:    string(tenantID),
+		Entries:     make([]AuditExportEntry, 0, len(entries)),
+		Checkpoints: make([]AuditExportCheckpoint, 0, len(checkpoints)),
+	}
+	for _, e := range entries {
+		exp.Entries = append(exp.Entries, AuditExportEntry{
+			Seq:       e.Seq,
+			ID:        e.ID,
+			UserID:    e.UserID,
+			EventType: e.EventType,
+			Payload:   e.Payload,
+			RequestID: e.RequestID,
+			IP:        e.IP,
+			UserAgent: e.UserAgent,
+			CreatedAt: e.CreatedAt,
+			PrevHash:  e.PrevHash,
+			Hash:      e.Hash,
+		})
+	}
+	for _, c := range checkpoints {
+		exp.Checkpoints = append(exp.Checkpoints, AuditExportCheckpoint{
+			Seq:       c.Seq,
+			Hash:      c.Hash,
+			Signature: c.Signature,
+			CreatedAt: c.CreatedAt,
+		})
+	}
+	return exp
+}
+
+// AuditViolation is one defect found in an audit chain. Seq is the entry or
+// checkpoint it concerns.
+type AuditViolation struct {
+	Seq    int64
+	Code   string
+	Detail string
+}
+
+func (v AuditViolation) String() string {
+	if v.Detail == "" {
+		return fmt.Sprintf("seq %d: %s", v.Seq, v.Code)
+	}
+	return fmt.Sprintf("seq %d: %s (%s)", v.Seq, v.Code, v.Detail)
+}
+
+// VerifyAuditExport checks an exported chain: entries must appear in order
+// from Seq 1 without gaps, each linked to the one before and matching its own
+// hash, and every checkpoint must be validly signed and match the entry at
+// its Seq. It returns every violation found; none means the chain is intact
+// up to its last entry.
+func VerifyAuditExport(exp *AuditExport, verifier AuditCheckpointVerifier) []AuditViolation {
+	var out []AuditViolation
+	tenantID := domain.TenantID(exp.TenantID)
+	bySeq := make(map[int64]string, len(exp.Entries))
+	var prev *domain.AuditLog
+	for _, x := range exp.Entries {
+		e := &domain.AuditLog{
+			ID:        x.ID,
+			TenantID:  tenantID,
+			UserID:    x.UserID,
+			EventType: x.EventType,
+			Payload:   x.Payload,
+			RequestID: x.RequestID,
+			IP:        x.IP,
+			UserAgent: x.UserAgent,
+			CreatedAt: x.CreatedAt,
+			Seq:       x.Seq,
+			PrevHash:  x.PrevHash,
+			Hash:      x.Hash,
+		}
+		want := int64(1)
+		wantPrev := ""
+		if prev != nil {
+			want, wantPrev = prev.Seq+1, prev.Hash
+		}
+		switch {
+		case e.Seq < want:
+			out = append(out, AuditViolation{Seq: e.Seq, Code: "out_of_order", Detail: fmt.Sprintf("expected seq %d", want)})
+		case e.Seq > want:
+			out = append(out, AuditViolation{Seq: e.Seq, Code: "gap", Detail: fmt.Sprintf("seq %d to %d missing", want, e.Seq-1)})
+		}
+		if e.PrevHash != wantPrev {
+			out = append(out, AuditViolation{Seq: e.Seq, Code: "broken_link", Detail: "prev_hash does not match the preceding entry"})
+		}
+		if AuditHash(e) != e.Hash {
+			out = append(out, AuditViolation{Seq: e.Seq, Code: "modified", Detail: "content does not match hash"})
+		}
+		bySeq[e.Seq] = e.Hash
+		prev = e
+	}
+
+	for _, c := range exp.Checkpoints {
+		cp := &domain.AuditCheckpoint{TenantID: tenantID, Seq: c.Seq, Hash: c.Hash, Signature: c.Signature, CreatedAt: c.CreatedAt}
+		if err := verifier.VerifyAuditCheckpoint(cp); err != nil {
+			out = append(out, AuditViolation{Seq: c.Seq, Code: "bad_checkpoint_signature", Detail: err.Error()})
+			continue
+		}
+		hash, ok := bySeq[c.Seq]
+		switch {
+		case !ok:
+			out = append(out, AuditViolation{Seq: c.Seq, Code: "checkpoint_entry_missing", Detail: "chain ends before a signed head"})
+		case hash != c.Hash:
+			out = append(out, AuditViolation{Seq: c.Seq, Code: "checkpoint_mismatch", Detail: "entry hash differs from the signed head"})
+		}
+	}
+	return out
+}
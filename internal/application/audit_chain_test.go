@@ -0,0 +1,122 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"trustpin_integration/internal/domain"
+)
+
+// testAuditExport chains n entries for one tenant and signs a checkpoint
+// over each seq in signed.
+func testAuditExport(n int, signed ...int64) *AuditExport {
+	var (
+		entries []*domain.AuditLog
+		head    *domain.AuditLog
+	)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		e := &domain.AuditLog{
+			ID:        fmt.Sprintf("a%d", i+1),
+			TenantID:  "t",
+			EventType: "mfa.challenge.created",
+			Payload:   fmt.Sprintf(`{"n":%d}`, i),
+			CreatedAt: start.Add(time.Duration(i) * time.Second),
+		}
+		ChainAuditEntry(head, e)
+		entries = append(entries, e)
+		head = e
+	}
+	var checkpoints []*domain.AuditCheckpoint
+	for _, seq := range signed {
+		e := entries[seq-1]
+		checkpoints = append(checkpoints, &domain.AuditCheckpoint{TenantID: "t", Seq: e.Seq, Hash: e.Hash, Signature: "sig"})
+	}
+	return newAuditExport("t", entries, checkpoints)
+}
+
+// signatureVerifier accepts checkpoints signed "sig".
+type signatureVerifier struct{}
+
+func (signatureVerifier) VerifyAuditCheckpoint(cp *domain.AuditCheckpoint) error {
+	if cp.Signature != "sig" {
+		return errors.New("bad signature")
+	}
+	return nil
+}
+
+func violationCodes(vs []AuditViolation) []string {
+	var out []string
+	for _, v := range vs {
+		out = append(out, fmt.Sprintf("%d:%s", v.Seq, v.Code))
+	}
+	return out
+}
+
+func TestVerifyAuditExport(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(exp *AuditExport)
+		want   []string
+	}{
+		{
+			name:   "intact",
+			tamper: func(exp *AuditExport) {},
+		},
+		{
+			name: "gap",
+			tamper: func(exp *AuditExport) {
+				exp.Entries = slices.Delete(exp.Entries, 2, 3)
+			},
+			want: []string{"4:gap", "4:broken_link"},
+		},
+		{
+			name: "reorder",
+			tamper: func(exp *AuditExport) {
+				exp.Entries[1], exp.Entries[2] = exp.Entries[2], exp.Entries[1]
+			},
+			want: []string{"3:gap", "3:broken_link", "2:out_of_order", "2:broken_link", "4:gap", "4:broken_link"},
+		},
+		{
+			name: "modification",
+			tamper: func(exp *AuditExport) {
+				exp.Entries[1].Payload = `{"n":99}`
+			},
+			want: []string{"2:modified"},
+		},
+		{
+			name: "checkpoint mismatch",
+			tamper: func(exp *AuditExport) {
+				exp.Checkpoints[0].Hash = exp.Entries[0].Hash
+			},
+			want: []string{"2:checkpoint_mismatch"},
+		},
+		{
+			name: "checkpoint signature",
+			tamper: func(exp *AuditExport) {
+				exp.Checkpoints[0].Signature = "forged"
+			},
+			want: []string{"2:bad_checkpoint_signature"},
+		},
+		{
+			name: "truncated before checkpoint",
+			tamper: func(exp *AuditExport) {
+				exp.Entries = exp.Entries[:1]
+			},
+			want: []string{"2:checkpoint_entry_missing"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exp := testAuditExport(4, 2)
+			tt.tamper(exp)
+			got := violationCodes(VerifyAuditExport(exp, signatureVerifier{}))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("violations = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,7 +2,7 @@ package application
 
 import (
 	"context"
-	"errors"
+	"log/slog"
 	"time"
 
 	"trustpin_integration/internal/domain"
@@ -11,28 +11,47 @@ import (
 type AuthService struct {
 	Users    UserRepository
 	Sessions SessionRepository
+	Audit    AuditRepository
+	Log      *slog.Logger
+	Policies *PolicyService
 	// JWT signing handled elsewhere; this service focuses on domain flow.
 }
 
-func (s *AuthService) Login(ctx context.Context, tenantID domain.TenantID, username, password string) (*domain.Session, error) {
+func (s *AuthService) Login(ctx context.Context, tenantID domain.TenantID, username, password string) (session *domain.Session, err error) {
+	defer func() {
+		userID := ""
+		if session != nil {
+			userID = session.UserID
+		}
+		log := s.Log
+		if log == nil {
+			log = slog.Default()
+		}
+		auditResult(ctx, s.Audit, log, tenantID, userID, auditLogin, err, map[string]any{"username": username})
+	}()
+
 	user, err := s.Users.GetByUsername(ctx, tenantID, username)
 	if err != nil {
 		return nil, err
 	}
 	if user == nil {
-		return nil, errors.New("invalid_credentials")
+		return nil, &Error{Kind: ErrUnauthenticated, Code: "invalid_credentials"}
 	}
 	// Password verification intentionally omitted; plug in password hasher.
 	if password == "" {
-		return nil, errors.New("invalid_credentials")
+		return nil, &Error{Kind: ErrUnauthenticated, Code: "invalid_credentials"}
 	}
 
-	session := &domain.Session{
+	pol, err := s.Policies.Effective(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	session = &domain.Session{
 		ID:        "",
 		TenantID:  tenantID,
 		UserID:    user.ID,
 		JWTID:     "",
-		ExpiresAt: time.Now().Add(15 * time.Minute),
+		ExpiresAt: time.Now().Add(pol.TokenTTL),
 	}
 	if err := s.Sessions.Create(ctx, session); err != nil {
 		return nil, err
@@ -0,0 +1,213 @@
+package application
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"trustpin_integration/internal/domain"
+)
+
+// ChallengeEvent announces that a challenge changed state. Subscribers treat
+// it as a hint and read the challenge again, so a lost or stale event only
+// delays an update.
+type ChallengeEvent struct {
+	TenantID    domain.TenantID `json:"tenant_id"`
+	ChallengeID string          `json:"challenge_id"`
+	State       string          `json:"state"`
+	At          time.Time       `json:"at"`
+	// Origin identifies the replica that published the event, so a broker
+	// can skip its own events when they come back through the relay.
+	Origin string `json:"origin"`
+}
+
+// ChallengeEventRelay carries challenge events between replicas, e.g. over
+// Redis pub/sub.
+type ChallengeEventRelay interface {
+	Publish(ctx context.Context, e ChallengeEvent) error
+	// Subscribe calls fn for every event published by any replica until ctx
+	// is cancelled.
+	Subscribe(ctx context.Context, fn func(ChallengeEvent)) error
+}
+
+// ChallengeBroker fans challenge events out to the requests waiting on them
+// in this process, and through Relay to the other replicas.
+type ChallengeBroker struct {
+	Relay ChallengeEventRelay
+
+	origin string
+	mu     sync.Mutex
+	subs   map[string]map[chan ChallengeEvent]struct{}
+}
+
+func NewChallengeBroker(relay ChallengeEventRelay) *ChallengeBroker {
+	return &ChallengeBroker{
+		Relay:  relay,
+		origin: newID(),
+		subs:   make(map[string]map[chan ChallengeEvent]struct{}),
+	}
+}
+
+// Subscribe returns a channel receiving the events of one challenge. The
+// channel holds one pending event; further events are dropped until it is
+// read, which is enough for a reader that re-reads the challenge. Call the
+// returned function to unsubscribe.
+func (b *ChallengeBroker) Subscribe(tenantID domain.TenantID, challengeID string) (<-chan ChallengeEvent, func()) {
+	key := eventKey(tenantID, challengeID)
+	ch := make(chan ChallengeEvent, 1)
+	b.mu.Lock()
+	if b.subs[key] == nil {
+		b.subs[key] = make(map[chan ChallengeEvent]struct{})
+	}
+	b.subs[key][ch] = struct{}{}
+	b.mu.Unlock()
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs[key], ch)
+		if len(b.subs[key]) == 0 {
+			delete(b.subs, key)
+		}
+	}
+}
+
+// Publish delivers e to local subscribers and hands it to the relay.
+func (b *ChallengeBroker) Publish(ctx context.Context, e ChallengeEvent) error {
+	e.Origin = b.origin
+	b.deliver(e)
+	if b.Relay == nil {
+		return nil
+	}
+	return b.Relay.Publish(ctx, e)
+}
+
+// Run delivers events published by other replicas until ctx is cancelled.
+// Without a relay it returns at once.
+func (b *ChallengeBroker) Run(ctx context.Context) error {
+	if b.Relay == nil {
+		return nil
+	}
+	return b.Relay.Subscribe(ctx, func(e ChallengeEvent) {
+		if e.Origin != b.origin {
+			b.deliver(e)
+		}
+	})
+}
+
+func (b *ChallengeBroker) deliver(e ChallengeEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs[eventKey(e.TenantID, e.ChallengeID)] {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+func eventKey(tenantID domain.TenantID, challengeID string) string {
+	return string(tenantID) + "/" + challengeID
+}
+
+// closeChallenge settles one of a user's open challenges as state, records
+// the change, tells the waiting clients and settles the fan-out the
+// challenge is part of. Only the first answer does: when the challenge was
+// no longer open it reports false and changes nothing.
+func (s *MFAService) closeChallenge(ctx context.Context, tenantID domain.TenantID, userID, id, state string) (bool, error) {
+	closed, err := s.Challenges.Close(ctx, tenantID, id, state)
+	if err != nil || !closed {
+		return false, err
+	}
+	s.challengeChanged(ctx, tenantID, userID, id, state)
+	s.settleFanOut(ctx, tenantID, id, state)
+	return true, nil
+}
+
+// challengeChanged records, audits and announces a state change already
+// stored. Failures are logged: the change itself stands, and clients fall
+// back to reading the challenge.
+func (s *MFAService) challengeChanged(ctx context.Context, tenantID domain.TenantID, userID, id, state string) {
+	s.recordTransition(ctx, tenantID, id, state)
+	err := s.audit(ctx, tenantID, userID, auditChallengeState, map[string]any{"challenge_id": id, "state": state})
+	if err != nil {
+		s.logger().Error("audit_append", "event", auditChallengeState, "error", err)
+	}
+	if s.Events == nil {
+		return
+	}
+	err = s.Events.Publish(ctx, ChallengeEvent{TenantID: tenantID, ChallengeID: id, State: state, At: time.Now()})
+	if err != nil {
+		s.logger().Error("challenge_event_publish", "tenant_id", tenantID, "challenge_id", id, "error", err)
+	}
+}
+
+// SubscribeChallenge returns a channel that receives a value whenever the
+// challenge may have changed, and a function to stop the subscription.
+// Without a broker the channel never fires.
+func (s *MFAService) SubscribeChallenge(tenantID domain.TenantID, id string) (<-chan ChallengeEvent, func()) {
+	if s.Events == nil {
+		return nil, func() {}
+	}
+	return s.Events.Subscribe(tenantID, id)
+}
+
+// ChallengeFor returns challenge id as userID may see it: one of their own,
+// or a quorum challenge they were asked to approve. Any other challenge is
+// reported as not found, so IDs of other users' challenges cannot be probed.
+func (s *MFAService) ChallengeFor(ctx context.Context, tenantID domain.TenantID, userID, id string) (*domain.MFAChallenge, error) {
+	c, err := s.Challenges.GetByID(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, NotFound("challenge", id)
+	}
+	if c.UserID == userID {
+		return c, nil
+	}
+	if c.Quorum > 0 {
+		members, err := s.Challenges.ListByParent(ctx, tenantID, c.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range members {
+			if m.UserID == userID {
+				return c, nil
+			}
+		}
+	}
+	return nil, NotFound("challenge", id)
+}
+
+// WaitChallenge returns challenge id as userID may see it once it is no
+// longer open, or as it is when ctx ends first.
+func (s *MFAService) WaitChallenge(ctx context.Context, tenantID domain.TenantID, userID, id string) (*domain.MFAChallenge, error) {
+	events, cancel := s.SubscribeChallenge(tenantID, id)
+	defer cancel()
+	for {
+		c, err := s.ChallengeFor(ctx, tenantID, userID, id)
+		if err != nil || !c.Open() {
+			return c, err
+		}
+		select {
+		case <-ctx.Done():
+			return c, nil
+		case <-events:
+		}
+	}
+}
+
+// ExpireChallenges closes open challenges of all tenants whose answer window
+// ended before now and tells the clients waiting on them. It returns the
+// number of challenges expired.
+func (s *MFAService) ExpireChallenges(ctx context.Context, now time.Time) (int, error) {
+	ctx = withActor(ctx, domain.ChallengeActorSweeper, "")
+	challenges, err := s.Challenges.ExpireOpen(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+	for _, c := range challenges {
+		s.challengeChanged(ctx, c.TenantID, c.UserID, c.ID, domain.ChallengeStateExpired)
+	}
+	return len(challenges), nil
+}
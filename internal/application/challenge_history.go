@@ -0,0 +1,120 @@
+package application
+
+import (
+	"context"
+	"time"
+
+	"trustpin_integration/internal/domain"
+)
+
+type transitionActorKey struct{}
+
+type transitionActor struct {
+	name          string
+	correlationID string
+}
+
+// withActor attributes the challenge transitions made with ctx to actor,
+// correlated by correlationID.
+func withActor(ctx context.Context, actor, correlationID string) context.Context {
+	return context.WithValue(ctx, transitionActorKey{}, transitionActor{actor, correlationID})
+}
+
+// actorFrom returns the actor set with withActor. Transitions made without
+// one are the user's, correlated by their request ID.
+func actorFrom(ctx context.Context) transitionActor {
+	if a, ok := ctx.Value(transitionActorKey{}).(transitionActor); ok {
+		return a
+	}
+	return transitionActor{domain.ChallengeActorUser, RequestMetaFrom(ctx).RequestID}
+}
+
+// createChallenge stores a new challenge and records its first state.
+func (s *MFAService) createChallenge(ctx context.Context, c *domain.MFAChallenge) error {
+	if err := s.Challenges.Create(ctx, c); err != nil {
+		return err
+	}
+	s.recordTransition(ctx, c.TenantID, c.ID, c.State)
+	return nil
+}
+
+// recordTransition appends a challenge reaching state to its history. The
+// change itself already stands, so a failure is logged.
+func (s *MFAService) recordTransition(ctx context.Context, tenantID domain.TenantID, id, state string) {
+	if s.History == nil {
+		return
+	}
+	a := actorFrom(ctx)
+	err := s.History.Append(ctx, &domain.ChallengeTransition{
+		TenantID:      tenantID,
+		ChallengeID:   id,
+		State:         state,
+		Actor:         a.name,
+		CorrelationID: a.correlationID,
+		At:            time.Now().UTC(),
+	})
+	if err != nil {
+		s.logger().Error("challenge_history_append", "tenant_id", tenantID, "challenge_id", id, "state", state, "error", err)
+	}
+}
+
+// ChallengeTimeline is a challenge with the transitions it went through,
+// oldest first, and for a fan-out the timelines of its devices' challenges.
+type ChallengeTimeline struct {
+	Challenge   *domain.MFAChallenge
+	Transitions []*domain.ChallengeTransition
+	Members     []*ChallengeTimeline
+}
+
+// ChallengeHistory returns the timeline of one of the user's challenges.
+func (s *MFAService) ChallengeHistory(ctx context.Context, tenantID domain.TenantID, userID, challengeID string) (*ChallengeTimeline, error) {
+	c, err := s.Challenges.GetByID(ctx, tenantID, challengeID)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil || c.UserID != userID {
+		return nil, NotFound("challenge", challengeID)
+	}
+	return s.timeline(ctx, c)
+}
+
+// AdminChallengeHistory returns the timeline of any challenge in the tenant.
+// The caller must be an admin or auditor of the tenant.
+func (s *MFAService) AdminChallengeHistory(ctx context.Context, tenantID domain.TenantID, callerID, challengeID string) (*ChallengeTimeline, error) {
+	if err := requireRole(ctx, s.Users, tenantID, callerID, domain.RoleAdmin, domain.RoleAuditor); err != nil {
+		return nil, err
+	}
+	c, err := s.Challenges.GetByID(ctx, tenantID, challengeID)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, NotFound("challenge", challengeID)
+	}
+	return s.timeline(ctx, c)
+}
+
+func (s *MFAService) timeline(ctx context.Context, c *domain.MFAChallenge) (*ChallengeTimeline, error) {
+	t := &ChallengeTimeline{Challenge: c}
+	if s.History != nil {
+		var err error
+		if t.Transitions, err = s.History.List(ctx, c.TenantID, c.ID); err != nil {
+			return nil, err
+		}
+	}
+	if !isFanOut(c) {
+		return t, nil
+	}
+	members, err := s.Challenges.ListByParent(ctx, c.TenantID, c.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range members {
+		mt, err := s.timeline(ctx, m)
+		if err != nil {
+			return nil, err
+		}
+		t.Members = append(t.Members, mt)
+	}
+	return t, nil
+}
@@ -0,0 +1,62 @@
+package application
+
+import (
+	"context"
+	"time"
+
+	"trustpin_integration/internal/domain"
+)
+
+// CleanupStaleDevices removes devices stuck in PENDING or PAIRING_PENDING
+// after their pairing window ended, e.g. because the process died in the
+// middle of an enrollment. It returns the number of devices removed.
+func (s *MFAService) CleanupStaleDevices(ctx context.Context, now time.Time) (int, error) {
+	devices, err := s.Devices.ListExpiredPairings(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, d := range devices {
+		if err := s.discardDevice(ctx, d); err != nil {
+			s.logger().Error("stale_device_cleanup_failed", "tenant_id", d.TenantID, "device_id", d.ID, "error", err)
+			continue
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// discardDevice deletes a device that never finished pairing or was revoked,
+// cancelling its open enrollment at Trustpin through the outbox.
+func (s *MFAService) discardDevice(ctx context.Context, d *domain.MFADevice) error {
+	return s.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.Devices.Delete(ctx, d.TenantID, d.ID); err != nil {
+			return err
+		}
+		if err := s.audit(ctx, d.TenantID, d.UserID, auditDeviceDiscard, map[string]any{"device_id": d.ID, "state": d.State}); err != nil {
+			return err
+		}
+		if d.State == domain.DeviceStatePairingPending && d.TrustPinEnrollID != "" {
+			return s.cancelEnrollment(ctx, d.TenantID, d.Provider, d.TrustPinEnrollID)
+		}
+		return nil
+	})
+}
+
+// cancelEnrollment queues cancellation of a pairing at provider.
+func (s *MFAService) cancelEnrollment(ctx context.Context, tenantID domain.TenantID, provider, enrollmentID string) error {
+	_, err := s.Outbox.Enqueue(ctx, tenantID, opTrustPinCancelEnrollment, "cancel_enrollment:"+enrollmentID, TrustPinCancelEnrollmentRequest{
+		TenantID:     string(tenantID),
+		EnrollmentID: enrollmentID,
+		Provider:     provider,
+	})
+	s.Outbox.Notify()
+	return err
+}
+
+func pairingExpired(d *domain.MFADevice, now time.Time) bool {
+	if d.State != domain.DeviceStatePending && d.State != domain.DeviceStatePairingPending {
+		return false
+	}
+	return d.PairingExpiresAt.Before(now)
+}
@@ -0,0 +1,158 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Error kinds. Errors returned by the services for known conditions match
+// exactly one of these with errors.Is, so every front-end (HTTP, gRPC, CLI)
+// can translate them without looking at message text.
+var (
+	ErrNotFound        = errors.New("not_found")
+	ErrConflict        = errors.New("conflict")
+	ErrInvalidState    = errors.New("invalid_state")
+	ErrExpired         = errors.New("expired")
+	ErrForbidden       = errors.New("forbidden")
+	ErrInvalidInput    = errors.New("invalid_input")
+	ErrUnauthenticated = errors.New("unauthenticated")
+	ErrUpstream        = errors.New("upstream_error")
+	ErrInvalidResponse = errors.New("upstream_invalid_response")
+	ErrTimeout         = errors.New("timeout")
+	ErrRateLimited     = errors.New("rate_limited")
+)
+
+var errorKinds = []error{
+	ErrNotFound,
+	ErrConflict,
+	ErrInvalidState,
+	ErrExpired,
+	ErrForbidden,
+	ErrInvalidInput,
+	ErrUnauthenticated,
+	ErrUpstream,
+	ErrInvalidResponse,
+	ErrTimeout,
+	ErrRateLimited,
+}
+
+// Error is a service error with context. Code is a stable machine-readable
+// identifier such as "nonce_reuse"; Entity and ID name what it concerns.
+type Error struct {
+	Kind   error
+	Code   string
+	Entity string
+	ID     string
+	Detail string
+	Err    error
+	// RetryAfter tells the caller when a rate-limited request may be
+	// repeated; zero when unknown.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	msg := e.Code
+	if e.Entity != "" {
+		msg += ": " + e.Entity
+		if e.ID != "" {
+			msg += " " + e.ID
+		}
+	}
+	if e.Detail != "" {
+		msg += " (" + e.Detail + ")"
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Is(target error) bool { return target == e.Kind }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+func NotFound(entity, id string) error {
+	return &Error{Kind: ErrNotFound, Code: "not_found", Entity: entity, ID: id}
+}
+
+func Conflict(code, entity, id string) error {
+	return &Error{Kind: ErrConflict, Code: code, Entity: entity, ID: id}
+}
+
+// InvalidState reports an entity that is not in a state the operation
+// accepts; state is the state it was found in, if it exists.
+func InvalidState(entity, id, state string) error {
+	return &Error{Kind: ErrInvalidState, Code: "invalid_state", Entity: entity, ID: id, Detail: state}
+}
+
+func Expired(entity, id string) error {
+	return &Error{Kind: ErrExpired, Code: "expired", Entity: entity, ID: id}
+}
+
+func Forbidden(code string) error {
+	return &Error{Kind: ErrForbidden, Code: code}
+}
+
+func InvalidInput(code string) error {
+	return &Error{Kind: ErrInvalidInput, Code: code}
+}
+
+// RateLimited reports a request refused by a limit; reason names the limit.
+func RateLimited(code, reason string, retryAfter time.Duration) error {
+	return &Error{Kind: ErrRateLimited, Code: code, Detail: reason, RetryAfter: retryAfter}
+}
+
+// InvalidResponse reports a provider response that arrived but does not
+// hold what the provider's API promises; reason says what is missing or
+// malformed. Repeating the call is not expected to help.
+func InvalidResponse(provider, reason string) error {
+	return &Error{Kind: ErrInvalidResponse, Code: "upstream_invalid_response", Entity: provider, Detail: reason}
+}
+
+// UpstreamError is a failed call to an upstream provider such as Trustpin.
+// Status is the upstream HTTP status, or zero when no response arrived.
+type UpstreamError struct {
+	Provider string
+	Status   int
+	Body     []byte
+	Err      error
+}
+
+func (e *UpstreamError) Error() string {
+	msg := e.Provider + "_error"
+	if e.Status != 0 {
+		msg += fmt.Sprintf(": status %d", e.Status)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *UpstreamError) Is(target error) bool { return target == ErrUpstream }
+
+func (e *UpstreamError) Unwrap() error { return e.Err }
+
+// Temporary reports whether repeating the call may succeed: transport
+// failures, rate limiting and server-side errors are, client errors are not.
+func (e *UpstreamError) Temporary() bool {
+	return e.Status == 0 || e.Status == http.StatusTooManyRequests || e.Status >= 500
+}
+
+// Classify returns the kind and code of err. Errors that match no kind yield
+// a nil kind and the code "internal_error".
+func Classify(err error) (kind error, code string) {
+	for _, k := range errorKinds {
+		if !errors.Is(err, k) {
+			continue
+		}
+		var e *Error
+		if errors.As(err, &e) && e.Kind == k {
+			return k, e.Code
+		}
+		return k, k.Error()
+	}
+	return nil, "internal_error"
+}
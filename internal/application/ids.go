@@ -0,0 +1,13 @@
+package application
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// newID returns a random 128-bit identifier in hex.
+func newID() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
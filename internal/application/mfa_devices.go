@@ -0,0 +1,139 @@
+package application
+
+import (
+	"context"
+
+	"trustpin_integration/internal/domain"
+)
+
+func (s *MFAService) ListDevices(ctx context.Context, tenantID domain.TenantID, userID string, offset, limit int) ([]*domain.MFADevice, int, error) {
+	return s.Devices.ListByUser(ctx, tenantID, userID, offset, limit)
+}
+
+func (s *MFAService) RenameDevice(ctx context.Context, tenantID domain.TenantID, userID, deviceID, name string) (_ *domain.MFADevice, err error) {
+	defer func() {
+		s.auditResult(ctx, tenantID, userID, auditDeviceRename, err, map[string]any{"device_id": deviceID, "name": name})
+	}()
+	d, err := s.ownedDevice(ctx, tenantID, userID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if d.State == domain.DeviceStateRevoked {
+		return nil, InvalidState("device", d.ID, d.State)
+	}
+	if err := s.Devices.UpdateName(ctx, tenantID, d.ID, name); err != nil {
+		return nil, err
+	}
+	return s.Devices.GetByID(ctx, tenantID, d.ID)
+}
+
+// SetPrimaryDevice makes the device the one challenges without a device go
+// to, or with primary false stops it being that. Only an active device can
+// become primary; the user's previous primary device stops being one.
+func (s *MFAService) SetPrimaryDevice(ctx context.Context, tenantID domain.TenantID, userID, deviceID string, primary bool) (_ *domain.MFADevice, err error) {
+	defer func() {
+		s.auditResult(ctx, tenantID, userID, auditDevicePrimary, err, map[string]any{"device_id": deviceID, "primary": primary})
+	}()
+	d, err := s.ownedDevice(ctx, tenantID, userID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case primary && d.State != domain.DeviceStateActive:
+		return nil, InvalidState("device", d.ID, d.State)
+	case primary:
+		err = s.Devices.SetPrimary(ctx, tenantID, userID, d.ID)
+	case d.Primary:
+		err = s.Devices.SetPrimary(ctx, tenantID, userID, "")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.Devices.GetByID(ctx, tenantID, d.ID)
+}
+
+// RevokeDevice marks the device REVOKED, cancels any challenges still
+// waiting on it and queues its revocation at Trustpin, all in one
+// transaction. A device that was never activated has its pairing cancelled
+// at Trustpin instead. Revoking an already revoked device is a no-op.
+func (s *MFAService) RevokeDevice(ctx context.Context, tenantID domain.TenantID, userID, deviceID string) (err error) {
+	defer func() {
+		s.auditResult(ctx, tenantID, userID, auditDeviceRevoke, err, map[string]any{"device_id": deviceID})
+	}()
+	d, err := s.ownedDevice(ctx, tenantID, userID, deviceID)
+	if err != nil {
+		return err
+	}
+	if d.State == domain.DeviceStateRevoked {
+		return nil
+	}
+	// Decided up front, as the store may hand out the device it updates.
+	state := d.State
+
+	var cancelled []string
+	err = s.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		cancelled = cancelled[:0]
+		if err := s.Devices.UpdateState(ctx, tenantID, d.ID, domain.DeviceStateRevoked); err != nil {
+			return err
+		}
+		if d.Primary {
+			if err := s.Devices.SetPrimary(ctx, tenantID, userID, ""); err != nil {
+				return err
+			}
+		}
+		challenges, err := s.Challenges.ListByDevice(ctx, tenantID, d.ID)
+		if err != nil {
+			return err
+		}
+		for _, c := range challenges {
+			if !c.Open() {
+				continue
+			}
+			if err := s.Challenges.UpdateState(ctx, tenantID, c.ID, domain.ChallengeStateCancelled); err != nil {
+				return err
+			}
+			cancelled = append(cancelled, c.ID)
+		}
+		// PENDING and TOTP devices never reached Trustpin, so there is
+		// nothing to revoke there; a PAIRING_PENDING device only has a
+		// pairing to cancel.
+		switch {
+		case state == domain.DeviceStatePending || isTOTP(d):
+			return nil
+		case state == domain.DeviceStatePairingPending:
+			if d.TrustPinEnrollID == "" {
+				return nil
+			}
+			return s.cancelEnrollment(ctx, tenantID, d.Provider, d.TrustPinEnrollID)
+		}
+		_, err = s.Outbox.Enqueue(ctx, tenantID, opTrustPinRevokeDevice, "revoke_device:"+d.ID+":"+d.TrustPinEnrollID, TrustPinRevokeRequest{
+			TenantID: string(tenantID),
+			UserID:   userID,
+			DeviceID: trustPinDeviceID(d),
+			Provider: d.Provider,
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, id := range cancelled {
+		s.challengeChanged(ctx, tenantID, userID, id, domain.ChallengeStateCancelled)
+		s.settleFanOut(ctx, tenantID, id, domain.ChallengeStateCancelled)
+	}
+	s.Outbox.Notify()
+	return nil
+}
+
+// ownedDevice loads a device by either of its IDs and hides devices that
+// belong to other users.
+func (s *MFAService) ownedDevice(ctx context.Context, tenantID domain.TenantID, userID, deviceID string) (*domain.MFADevice, error) {
+	d, err := s.FindDevice(ctx, tenantID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil || d.UserID != userID {
+		return nil, NotFound("device", deviceID)
+	}
+	return d, nil
+}
@@ -0,0 +1,231 @@
+package application
+
+import (
+	"context"
+	"slices"
+
+	"trustpin_integration/internal/domain"
+)
+
+// challengeDevices resolves the devices a challenge goes to. A named device
+// must be active and allowed by the tenant policy. Otherwise the user's
+// primary device is used, then all of their active Trustpin devices, then
+// their first active TOTP device.
+func (s *MFAService) challengeDevices(ctx context.Context, tenantID domain.TenantID, userID, deviceID string, pol *domain.TenantPolicy) ([]*domain.MFADevice, error) {
+	if deviceID != "" {
+		d, err := s.FindDevice(ctx, tenantID, deviceID)
+		if err != nil {
+			return nil, err
+		}
+		if d == nil {
+			return nil, InvalidState("device", deviceID, "")
+		}
+		if d.State != domain.DeviceStateActive {
+			return nil, InvalidState("device", d.ID, d.State)
+		}
+		if !pol.AllowsFactor(d.Type) {
+			return nil, Forbidden("factor_not_allowed")
+		}
+		return []*domain.MFADevice{d}, nil
+	}
+
+	devices, _, err := s.Devices.ListByUser(ctx, tenantID, userID, 0, loginDeviceScan)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		push   []*domain.MFADevice
+		totp   *domain.MFADevice
+		active bool
+	)
+	for _, d := range devices {
+		if d.State != domain.DeviceStateActive {
+			continue
+		}
+		active = true
+		if !pol.AllowsFactor(d.Type) {
+			continue
+		}
+		if d.Primary {
+			return []*domain.MFADevice{d}, nil
+		}
+		if !isTOTP(d) {
+			push = append(push, d)
+		} else if totp == nil {
+			totp = d
+		}
+	}
+	switch {
+	case len(push) > 0:
+		return push, nil
+	case totp != nil:
+		return []*domain.MFADevice{totp}, nil
+	case active:
+		return nil, Forbidden("factor_not_allowed")
+	}
+	return nil, InvalidState("device", "", "")
+}
+
+// youngestDevice returns the most recently enrolled of devices. A fan-out
+// is scored as if that device answered, since any of them may.
+func youngestDevice(devices []*domain.MFADevice) *domain.MFADevice {
+	y := devices[0]
+	for _, d := range devices[1:] {
+		if d.CreatedAt.After(y.CreatedAt) {
+			y = d
+		}
+	}
+	return y
+}
+
+// createFanOut pushes the logical challenge parent to each device as a
+// challenge of its own and stores those under parent. Devices the push fails
+// for are skipped; the fan-out fails only when no device was reached.
+func (s *MFAService) createFanOut(ctx context.Context, parent *domain.MFAChallenge, devices []*domain.MFADevice, req TrustPinChallengeRequest, number string) (*TrustPinChallengeResponse, error) {
+	var (
+		subs    []*domain.MFAChallenge
+		ids     []string
+		lastErr error
+	)
+	for _, d := range devices {
+		res, err := s.sendChallenge(ctx, d, req, number)
+		if err != nil {
+			s.logger().Warn("fanout_push_failed", "tenant_id", parent.TenantID, "challenge_id", parent.ID, "device_id", d.ID, "error", err)
+			lastErr = err
+			continue
+		}
+		subs = append(subs, newMember(parent, d, res, number))
+		ids = append(ids, d.ID)
+	}
+	if len(subs) == 0 {
+		return nil, lastErr
+	}
+
+	parent.State = domain.ChallengeStatePushSent
+	parent.NumberMatch = number
+	if err := s.createChallenge(ctx, parent); err != nil {
+		return nil, err
+	}
+	for _, sub := range subs {
+		if err := s.createChallenge(ctx, sub); err != nil {
+			return nil, err
+		}
+	}
+	res := challengeResponse(parent)
+	res.NumberMatch = number
+	res.Devices = ids
+	return res, nil
+}
+
+// newMember returns the challenge of parent pushed to device d.
+func newMember(parent *domain.MFAChallenge, d *domain.MFADevice, res *TrustPinChallengeResponse, number string) *domain.MFAChallenge {
+	sub := *parent
+	sub.ID = res.ChallengeID
+	sub.UserID = d.UserID
+	sub.DeviceID = d.ID
+	sub.State = res.State
+	sub.TrustPinChallengeID = res.ChallengeID
+	sub.NumberMatch = number
+	sub.ParentID = parent.ID
+	return &sub
+}
+
+// isFanOut reports whether c is the logical challenge of a fan-out, which
+// is answered through the challenges of its devices.
+func isFanOut(c *domain.MFAChallenge) bool {
+	return c.DeviceID == "" && c.RiskDecision != domain.RiskDecisionAllow && c.RiskDecision != domain.RiskDecisionDeny
+}
+
+// fanOutMember returns the challenge parent sent to userID's device with
+// either of its IDs. Users the fan-out did not reach see neither.
+func (s *MFAService) fanOutMember(ctx context.Context, parent *domain.MFAChallenge, userID, deviceID string) (*domain.MFAChallenge, error) {
+	d, err := s.ownedDevice(ctx, parent.TenantID, userID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	subs, err := s.Challenges.ListByParent(ctx, parent.TenantID, parent.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, sub := range subs {
+		if sub.DeviceID == d.ID {
+			return sub, nil
+		}
+	}
+	if parent.UserID != userID {
+		return nil, NotFound("challenge", parent.ID)
+	}
+	return nil, InvalidState("challenge", parent.ID, parent.State)
+}
+
+// settleFanOut carries a state change of a fan-out challenge across the
+// fan-out. The first device to approve or deny decides the logical challenge
+// and the other devices' challenges are cancelled; devices that drop out by
+// expiring or being revoked end it only once none is left. Settling the
+// logical challenge itself, as Deny does, cancels all of its devices'
+// challenges. Failures are logged, as the change that triggered them stands.
+func (s *MFAService) settleFanOut(ctx context.Context, tenantID domain.TenantID, id, state string) {
+	if err := s.settleFanOutErr(ctx, tenantID, id, state); err != nil {
+		s.logger().Error("fanout_settle", "tenant_id", tenantID, "challenge_id", id, "state", state, "error", err)
+	}
+}
+
+func (s *MFAService) settleFanOutErr(ctx context.Context, tenantID domain.TenantID, id, state string) error {
+	c, err := s.Challenges.GetByID(ctx, tenantID, id)
+	if err != nil || c == nil {
+		return err
+	}
+	parentID := c.ParentID
+	if parentID == "" {
+		if !isFanOut(c) {
+			return nil
+		}
+		parentID = c.ID
+	}
+	members, err := s.Challenges.ListByParent(ctx, tenantID, parentID)
+	if err != nil {
+		return err
+	}
+
+	if c.ParentID != "" {
+		parent, err := s.Challenges.GetByID(ctx, tenantID, parentID)
+		if err != nil || parent == nil {
+			return err
+		}
+		if parent.Quorum > 0 {
+			return s.settleQuorum(ctx, parent, c, state, members)
+		}
+		if !decisive(state) && slices.ContainsFunc(members, (*domain.MFAChallenge).Open) {
+			return nil
+		}
+		closed, err := s.Challenges.Close(ctx, tenantID, parentID, state)
+		if err != nil || !closed {
+			return err
+		}
+		s.challengeChanged(ctx, tenantID, parent.UserID, parentID, state)
+	}
+	return s.cancelMembers(ctx, members)
+}
+
+// cancelMembers cancels the challenges of members still open.
+func (s *MFAService) cancelMembers(ctx context.Context, members []*domain.MFAChallenge) error {
+	for _, m := range members {
+		if !m.Open() {
+			continue
+		}
+		closed, err := s.Challenges.Close(ctx, m.TenantID, m.ID, domain.ChallengeStateCancelled)
+		if err != nil {
+			return err
+		}
+		if closed {
+			s.challengeChanged(ctx, m.TenantID, m.UserID, m.ID, domain.ChallengeStateCancelled)
+		}
+	}
+	return nil
+}
+
+// decisive reports whether state is an answer rather than a challenge
+// lapsing or being withdrawn.
+func decisive(state string) bool {
+	return state == domain.ChallengeStateApproved || state == domain.ChallengeStateDenied
+}
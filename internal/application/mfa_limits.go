@@ -0,0 +1,237 @@
+package application
+
+import (
+	"context"
+	"time"
+
+	"trustpin_integration/internal/domain"
+)
+
+const (
+	codeChallengeRateLimited = "challenge_rate_limited"
+	auditUserLocked          = "mfa.user.locked"
+	// lockoutMemory is how long denial and lockout counts survive, counted
+	// from the first denial or lockout they record; later ones do not extend
+	// it. Each lockout inside it lasts twice as long as the last.
+	lockoutMemory = 24 * time.Hour
+)
+
+// ChallengeLimits bounds how many challenges a user can trigger, to stop a
+// caller holding a stolen password from flooding the user with pushes. A
+// zero field disables that limit.
+type ChallengeLimits struct {
+	MaxOutstandingPerUser   int
+	MaxOutstandingPerDevice int
+	MaxRecentPerUser        int
+	MaxRecentPerDevice      int
+	RecentWindow            time.Duration
+	// After MaxConsecutiveDenials denials in a row the user cannot get new
+	// challenges for LockoutBase, doubling with every further lockout up to
+	// LockoutMax.
+	MaxConsecutiveDenials int
+	LockoutBase           time.Duration
+	LockoutMax            time.Duration
+}
+
+// limits returns the tenant's challenge limits: the configured ones, with
+// the lockout thresholds of its policy applied.
+func (s *MFAService) limits(ctx context.Context, tenantID domain.TenantID) (ChallengeLimits, error) {
+	l, ok := s.TenantLimits[tenantID]
+	if !ok {
+		l = s.Limits
+	}
+	pol, err := s.policy(ctx, tenantID)
+	if err != nil {
+		return ChallengeLimits{}, err
+	}
+	if pol.MaxConsecutiveDenials != 0 {
+		l.MaxConsecutiveDenials = pol.MaxConsecutiveDenials
+	}
+	if pol.LockoutBase != 0 {
+		l.LockoutBase = pol.LockoutBase
+	}
+	if pol.LockoutMax != 0 {
+		l.LockoutMax = pol.LockoutMax
+	}
+	return l, nil
+}
+
+// checkChallengeLimits refuses a new challenge for devices, all belonging to
+// one user, while the user is locked out or over one of the tenant's limits.
+// A fan-out counts once towards the user's limits and once on each device.
+func (s *MFAService) checkChallengeLimits(ctx context.Context, devices []*domain.MFADevice) error {
+	if s.Counters == nil {
+		return nil
+	}
+	tenantID, userID := devices[0].TenantID, devices[0].UserID
+	l, err := s.limits(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	until, err := s.Counters.Get(ctx, tenantID, lockKey(userID))
+	if err != nil {
+		return err
+	}
+	if wait := time.Unix(until, 0).Sub(now); until != 0 && wait > 0 {
+		return RateLimited(codeChallengeRateLimited, "locked", wait)
+	}
+
+	if l.MaxOutstandingPerUser > 0 || l.MaxOutstandingPerDevice > 0 {
+		open, err := s.Challenges.ListOpenByUser(ctx, tenantID, userID, now)
+		if err != nil {
+			return err
+		}
+		onUser, onDevice := 0, make(map[string]int)
+		for _, c := range open {
+			if c.ParentID == "" {
+				onUser++
+			}
+			onDevice[c.DeviceID]++
+		}
+		if l.MaxOutstandingPerUser > 0 && onUser >= l.MaxOutstandingPerUser {
+			return RateLimited(codeChallengeRateLimited, "outstanding_per_user", 0)
+		}
+		for _, d := range devices {
+			if l.MaxOutstandingPerDevice > 0 && onDevice[d.ID] >= l.MaxOutstandingPerDevice {
+				return RateLimited(codeChallengeRateLimited, "outstanding_per_device", 0)
+			}
+		}
+	}
+
+	if l.RecentWindow <= 0 {
+		return nil
+	}
+	if l.MaxRecentPerUser > 0 {
+		n, err := s.Counters.Incr(ctx, tenantID, "mfa_recent_user:"+userID, l.RecentWindow)
+		if err != nil {
+			return err
+		}
+		if n > int64(l.MaxRecentPerUser) {
+			return RateLimited(codeChallengeRateLimited, "recent_per_user", 0)
+		}
+	}
+	if l.MaxRecentPerDevice > 0 {
+		for _, d := range devices {
+			n, err := s.Counters.Incr(ctx, tenantID, "mfa_recent_device:"+d.ID, l.RecentWindow)
+			if err != nil {
+				return err
+			}
+			if n > int64(l.MaxRecentPerDevice) {
+				return RateLimited(codeChallengeRateLimited, "recent_per_device", 0)
+			}
+		}
+	}
+	return nil
+}
+
+// recordOutcome tracks consecutive denials for the user of a challenge that
+// just reached state. An approval clears the count; enough denials in a row
+// lock the user out. Failures are logged, as the challenge itself has
+// already been settled.
+func (s *MFAService) recordOutcome(ctx context.Context, tenantID domain.TenantID, userID, state string) {
+	if s.Counters == nil || userID == "" {
+		return
+	}
+	var err error
+	switch state {
+	case domain.ChallengeStateApproved:
+		err = s.Counters.Delete(ctx, tenantID, denialsKey(userID))
+	case domain.ChallengeStateDenied:
+		err = s.recordDenial(ctx, tenantID, userID)
+	}
+	if err != nil {
+		s.logger().Error("challenge_outcome", "tenant_id", tenantID, "user_id", userID, "state", state, "error", err)
+	}
+}
+
+func (s *MFAService) recordDenial(ctx context.Context, tenantID domain.TenantID, userID string) error {
+	l, err := s.limits(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	if l.MaxConsecutiveDenials <= 0 || l.LockoutBase <= 0 {
+		return nil
+	}
+	n, err := s.Counters.Incr(ctx, tenantID, denialsKey(userID), lockoutMemory)
+	if err != nil {
+		return err
+	}
+	if n < int64(l.MaxConsecutiveDenials) {
+		return nil
+	}
+
+	level, err := s.Counters.Incr(ctx, tenantID, "mfa_lockouts:"+userID, lockoutMemory)
+	if err != nil {
+		return err
+	}
+	wait := lockoutDuration(l, level)
+	until := time.Now().Add(wait)
+	if err := s.Counters.Set(ctx, tenantID, lockKey(userID), until.Unix(), wait); err != nil {
+		return err
+	}
+	if err := s.Counters.Delete(ctx, tenantID, denialsKey(userID)); err != nil {
+		return err
+	}
+	s.logger().Warn("mfa_user_locked", "tenant_id", tenantID, "user_id", userID, "until", until)
+	return s.audit(ctx, tenantID, userID, auditUserLocked, map[string]any{
+		"denials": n,
+		"until":   until.UTC().Format(time.RFC3339),
+	})
+}
+
+// lockoutDuration returns the length of the level-th lockout: LockoutBase,
+// doubled for each earlier lockout and capped at LockoutMax.
+func lockoutDuration(l ChallengeLimits, level int64) time.Duration {
+	wait := l.LockoutBase
+	for i := int64(1); i < level; i++ {
+		wait *= 2
+		if l.LockoutMax > 0 && wait >= l.LockoutMax {
+			return l.LockoutMax
+		}
+	}
+	if l.LockoutMax > 0 && wait > l.LockoutMax {
+		return l.LockoutMax
+	}
+	return wait
+}
+
+// Deny closes one of the user's open challenges as not initiated by them and
+// counts it towards a lockout.
+func (s *MFAService) Deny(ctx context.Context, tenantID domain.TenantID, userID, challengeID string) (_ *TrustPinApproveResponse, err error) {
+	defer func() {
+		s.auditResult(ctx, tenantID, userID, auditChallengeDeny, err, map[string]any{"challenge_id": challengeID})
+	}()
+	c, err := s.Challenges.GetByID(ctx, tenantID, challengeID)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil || c.UserID != userID {
+		return nil, NotFound("challenge", challengeID)
+	}
+	if !c.Open() {
+		return nil, InvalidState("challenge", c.ID, c.State)
+	}
+	if err := s.denyChallenge(ctx, c); err != nil {
+		return nil, err
+	}
+	return &TrustPinApproveResponse{ChallengeID: c.ID, Status: domain.ChallengeStateDenied}, nil
+}
+
+// denyChallenge closes c as denied and counts the denial against its owner.
+// It fails when another answer settled c first.
+func (s *MFAService) denyChallenge(ctx context.Context, c *domain.MFAChallenge) error {
+	closed, err := s.closeChallenge(ctx, c.TenantID, c.UserID, c.ID, domain.ChallengeStateDenied)
+	if err != nil {
+		return err
+	}
+	if !closed {
+		return Conflict("challenge_settled", "challenge", c.ID)
+	}
+	s.recordOutcome(ctx, c.TenantID, c.UserID, domain.ChallengeStateDenied)
+	return nil
+}
+
+func lockKey(userID string) string    { return "mfa_lock:" + userID }
+func denialsKey(userID string) string { return "mfa_denials:" + userID }
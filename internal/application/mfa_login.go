@@ -0,0 +1,154 @@
+package application
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"trustpin_integration/internal/domain"
+)
+
+const (
+	loginAction = "login"
+	// loginDeviceScan caps how many of the user's devices are considered
+	// when picking the ones to challenge.
+	loginDeviceScan = 100
+)
+
+type LoginMFA struct {
+	TransactionID string                     `json:"mfa_transaction_id"`
+	Challenge     *TrustPinChallengeResponse `json:"challenge"`
+	ExpiresAt     time.Time                  `json:"-"`
+}
+
+// BeginLoginMFA starts the second factor of a password login. Users without
+// an active device, and every user of a tenant whose policy does not require
+// MFA at login, get nil and may be issued a token directly; everyone else
+// gets a challenge, tracked by an MFA transaction, on their primary device or
+// fanned out to their allowed devices as CreateChallenge does without a
+// device.
+func (s *MFAService) BeginLoginMFA(ctx context.Context, tenantID domain.TenantID, userID string) (login *LoginMFA, err error) {
+	defer func() {
+		if login == nil && err == nil {
+			return
+		}
+		payload := map[string]any{}
+		if login != nil {
+			payload["mfa_transaction_id"] = login.TransactionID
+			payload["challenge_id"] = login.Challenge.ChallengeID
+		}
+		s.auditResult(ctx, tenantID, userID, auditLoginMFABegin, err, payload)
+	}()
+	pol, err := s.policy(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if !pol.RequiresMFA(loginAction) {
+		return nil, nil
+	}
+	devices, _, err := s.Devices.ListByUser(ctx, tenantID, userID, 0, loginDeviceScan)
+	if err != nil {
+		return nil, err
+	}
+	// Skipping MFA for users whose factors were disallowed would let a
+	// policy change weaken their logins, so only users without any active
+	// device go without; CreateChallenge refuses the others.
+	if !slices.ContainsFunc(devices, func(d *domain.MFADevice) bool { return d.State == domain.DeviceStateActive }) {
+		return nil, nil
+	}
+
+	ch, err := s.CreateChallenge(ctx, tenantID, userID, TrustPinChallengeRequest{
+		TenantID: string(tenantID),
+		UserID:   userID,
+		Action:   loginAction,
+	})
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	expiresAt := now.Add(pol.ChallengeTTL)
+	if exp, err := time.Parse(time.RFC3339, ch.ExpiresAt); err == nil {
+		expiresAt = exp
+	}
+	t := &domain.MFATransaction{
+		ID:          newID(),
+		TenantID:    tenantID,
+		UserID:      userID,
+		ChallengeID: ch.ChallengeID,
+		State:       domain.MFATransactionStatePending,
+		ExpiresAt:   expiresAt,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := s.Transactions.Create(ctx, t); err != nil {
+		return nil, err
+	}
+	return &LoginMFA{TransactionID: t.ID, Challenge: ch, ExpiresAt: t.ExpiresAt}, nil
+}
+
+// CompleteLoginMFA succeeds once the transaction's challenge is approved and
+// returns the claims for the access token the caller then issues. A TOTP
+// challenge can be answered here with totpCode, and any open challenge with
+// one of the user's recovery codes. Each transaction completes only once.
+func (s *MFAService) CompleteLoginMFA(ctx context.Context, tenantID domain.TenantID, userID, transactionID, totpCode, recoveryCode string) (_ *Elevation, err error) {
+	defer func() {
+		s.auditResult(ctx, tenantID, userID, auditLoginMFAComplete, err, map[string]any{"mfa_transaction_id": transactionID})
+	}()
+	t, err := s.Transactions.GetByID(ctx, tenantID, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil || t.UserID != userID {
+		return nil, NotFound("mfa_transaction", transactionID)
+	}
+	if t.State != domain.MFATransactionStatePending {
+		return nil, Conflict("mfa_transaction_used", "mfa_transaction", t.ID)
+	}
+	if time.Now().After(t.ExpiresAt) {
+		return nil, Expired("mfa_transaction", t.ID)
+	}
+
+	c, err := s.Challenges.GetByID(ctx, tenantID, t.ChallengeID)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, NotFound("challenge", t.ChallengeID)
+	}
+	if c.State == domain.ChallengeStateCodeRequired && totpCode != "" {
+		if _, err := s.approveTOTP(ctx, c, totpCode); err != nil {
+			return nil, err
+		}
+		c.State, c.UpdatedAt = domain.ChallengeStateApproved, time.Now()
+	}
+	if c.Open() && recoveryCode != "" {
+		// The user lost the device the challenge went to.
+		if _, err := s.RedeemRecoveryCode(ctx, tenantID, userID, c.ID, recoveryCode); err != nil {
+			return nil, err
+		}
+		c.State, c.UpdatedAt = domain.ChallengeStateApproved, time.Now()
+	}
+	switch c.State {
+	case domain.ChallengeStateApproved:
+	case domain.ChallengeStatePushSent, domain.ChallengeStateCodeRequired:
+		return nil, Conflict("mfa_pending", "challenge", c.ID)
+	case domain.ChallengeStateDenied:
+		return nil, Forbidden("mfa_denied")
+	default:
+		return nil, Expired("challenge", c.ID)
+	}
+
+	ok, err := s.Transactions.Complete(ctx, tenantID, t.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, Conflict("mfa_transaction_used", "mfa_transaction", t.ID)
+	}
+	e, err := s.elevation(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	e.AMR = append([]string{"pwd"}, e.AMR...)
+	return e, nil
+}
@@ -0,0 +1,49 @@
+package application
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"slices"
+
+	"trustpin_integration/internal/domain"
+)
+
+// numberMatchKey is the field carrying the number in the Trustpin challenge
+// context and in the signed approval payload.
+const numberMatchKey = "number_match"
+
+// NumberMatchPolicy selects the push challenges that use number matching:
+// every challenge in the listed tenants, and challenges for the listed
+// actions in any tenant.
+type NumberMatchPolicy struct {
+	Tenants []string
+	Actions []string
+}
+
+func (p NumberMatchPolicy) Required(tenantID domain.TenantID, action string) bool {
+	return slices.Contains(p.Tenants, string(tenantID)) || slices.Contains(p.Actions, action)
+}
+
+// newMatchNumber returns a two-digit number for the user to pick on the
+// device. Leading zeros are avoided so it reads the same everywhere.
+func newMatchNumber() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(90))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprint(n.Int64() + 10), nil
+}
+
+// payloadNumber extracts the echoed number from an approval payload. JSON
+// numbers and strings are both accepted.
+func payloadNumber(payload map[string]any) string {
+	switch v := payload[numberMatchKey].(type) {
+	case string:
+		return v
+	case float64:
+		return fmt.Sprint(v)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,92 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+
+	"trustpin_integration/internal/domain"
+)
+
+// Provider operations delivered through the outbox. The names predate
+// providers and are kept so queued messages still match.
+const (
+	opTrustPinApprove          = "trustpin.approve"
+	opTrustPinRevokeDevice     = "trustpin.revoke_device"
+	opTrustPinCancelEnrollment = "trustpin.cancel_enrollment"
+)
+
+// RegisterOutboxHandlers wires the service's provider operations into its
+// outbox dispatcher. Each message names its provider; messages queued before
+// providers were named go to Trustpin. Call it once at startup.
+func (s *MFAService) RegisterOutboxHandlers() {
+	s.Outbox.Register(opTrustPinApprove, s.deliverApprove)
+	s.Outbox.Register(opTrustPinRevokeDevice, func(ctx context.Context, m *domain.OutboxMessage) ([]byte, error) {
+		var req TrustPinRevokeRequest
+		if err := json.Unmarshal(m.Payload, &req); err != nil {
+			return nil, permanent(err)
+		}
+		p, err := s.namedProvider(req.Provider)
+		if err != nil {
+			return nil, permanent(err)
+		}
+		return nil, p.RevokeDevice(ctx, req)
+	})
+	s.Outbox.Register(opTrustPinCancelEnrollment, func(ctx context.Context, m *domain.OutboxMessage) ([]byte, error) {
+		var req TrustPinCancelEnrollmentRequest
+		if err := json.Unmarshal(m.Payload, &req); err != nil {
+			return nil, permanent(err)
+		}
+		p, err := s.namedProvider(req.Provider)
+		if err != nil {
+			return nil, permanent(err)
+		}
+		pp, ok := p.(PairingProvider)
+		if !ok {
+			return nil, permanent(InvalidState("provider", p.Name(), ""))
+		}
+		return nil, pp.CancelEnrollment(ctx, req)
+	})
+}
+
+// deliverApprove forwards an approval to its provider and records the
+// outcome on the challenge, unless the challenge was settled meanwhile. A
+// crash between the two leaves the message pending, and the retry reaches
+// the provider with the same idempotency key.
+func (s *MFAService) deliverApprove(ctx context.Context, m *domain.OutboxMessage) ([]byte, error) {
+	var req TrustPinApproveRequest
+	if err := json.Unmarshal(m.Payload, &req); err != nil {
+		return nil, permanent(err)
+	}
+	p, err := s.namedProvider(req.Provider)
+	if err != nil {
+		return nil, permanent(err)
+	}
+	// The outcome is recorded for the challenge's owner rather than the
+	// user in the queued request.
+	c, err := s.Challenges.GetByID(ctx, m.TenantID, req.ChallengeID)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, permanent(NotFound("challenge", req.ChallengeID))
+	}
+	if !c.Open() {
+		// It expired, was cancelled or was answered otherwise before the
+		// approval got out; a late approval must not reopen it.
+		return nil, permanent(InvalidState("challenge", c.ID, c.State))
+	}
+	res, err := p.Approve(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	key, _ := IdempotencyKey(ctx)
+	ctx = withActor(ctx, domain.ChallengeActorReconciler, key)
+	closed, err := s.closeChallenge(ctx, m.TenantID, c.UserID, c.ID, res.Status)
+	if err != nil {
+		return nil, err
+	}
+	if closed {
+		s.recordOutcome(ctx, m.TenantID, c.UserID, res.Status)
+	}
+	return json.Marshal(res)
+}
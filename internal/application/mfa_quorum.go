@@ -0,0 +1,277 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"time"
+
+	"trustpin_integration/internal/domain"
+)
+
+// maxQuorumApprovers bounds the approvers one quorum challenge can ask.
+const maxQuorumApprovers = 10
+
+// quorumRequesterKey names the user asking for approval in the challenge
+// context sent to the approvers' devices.
+const quorumRequesterKey = "requested_by"
+
+// QuorumChallengeRequest asks Required of Approvers to approve Action.
+type QuorumChallengeRequest struct {
+	Action    string
+	Approvers []string
+	Required  int
+	Context   map[string]any
+}
+
+// QuorumTally is where a quorum challenge stands: how many approvers
+// approved, denied or may still answer, and each approver's answer.
+type QuorumTally struct {
+	Required  int
+	Approved  int
+	Denied    int
+	Pending   int
+	Approvers []QuorumVote
+}
+
+// QuorumVote is an approver's answer: APPROVED or DENIED, PUSH_SENT while
+// they may still answer, or EXPIRED or CANCELLED when they can no longer.
+type QuorumVote struct {
+	UserID string
+	State  string
+}
+
+// CreateQuorumChallenge asks other users of the tenant to approve action on
+// behalf of the caller, who must be an admin. Each approver's active push
+// devices receive a challenge of their own; the quorum challenge is approved
+// once req.Required approvers approved and denied once that can no longer
+// happen. Approvers without a reachable device are left out, and the
+// challenge is refused when too few remain.
+func (s *MFAService) CreateQuorumChallenge(ctx context.Context, tenantID domain.TenantID, userID string, req QuorumChallengeRequest) (res *TrustPinChallengeResponse, err error) {
+	defer func() {
+		payload := map[string]any{"action": req.Action, "approvers": req.Approvers, "quorum": req.Required}
+		if res != nil {
+			payload["challenge_id"] = res.ChallengeID
+			payload["devices"] = res.Devices
+		}
+		s.auditResult(ctx, tenantID, userID, auditChallengeCreate, err, payload)
+	}()
+	if err := requireRole(ctx, s.Users, tenantID, userID, domain.RoleAdmin); err != nil {
+		return nil, err
+	}
+	if err := validateQuorum(userID, req); err != nil {
+		return nil, err
+	}
+	tx, err := declaredTransaction(req.Context)
+	if err != nil {
+		return nil, err
+	}
+	pol, err := s.policy(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	parent := &domain.MFAChallenge{
+		ID:        newID(),
+		TenantID:  tenantID,
+		UserID:    userID,
+		Action:    req.Action,
+		State:     domain.ChallengeStatePushSent,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(pol.ChallengeTTL),
+		UpdatedAt: now,
+		Quorum:    req.Required,
+	}
+	pushCtx := make(map[string]any, len(req.Context)+1)
+	for k, v := range req.Context {
+		pushCtx[k] = v
+	}
+	pushCtx[quorumRequesterKey] = userID
+	if tx != nil {
+		parent.TransactionHash = tx.Hash
+		parent.TransactionText = tx.Text
+		pushCtx = withTransaction(pushCtx, tx)
+	}
+
+	var (
+		members []*domain.MFAChallenge
+		reached []string
+		ids     []string
+	)
+	for _, approver := range req.Approvers {
+		devices, err := s.quorumDevices(ctx, tenantID, approver, pol)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range devices {
+			pushed, err := s.sendChallenge(ctx, d, TrustPinChallengeRequest{
+				TenantID: string(tenantID),
+				UserID:   approver,
+				Action:   req.Action,
+				Context:  pushCtx,
+			}, "")
+			if err != nil {
+				s.logger().Warn("quorum_push_failed", "tenant_id", tenantID, "challenge_id", parent.ID, "user_id", approver, "device_id", d.ID, "error", err)
+				continue
+			}
+			members = append(members, newMember(parent, d, pushed, ""))
+			ids = append(ids, d.ID)
+			if !slices.Contains(reached, approver) {
+				reached = append(reached, approver)
+			}
+		}
+	}
+	if len(reached) < req.Required {
+		// Challenges already pushed lapse at Trustpin unanswered.
+		return nil, Conflict("quorum_unreachable", "challenge", parent.ID)
+	}
+
+	if err := s.createChallenge(ctx, parent); err != nil {
+		return nil, err
+	}
+	for _, m := range members {
+		if err := s.createChallenge(ctx, m); err != nil {
+			return nil, err
+		}
+	}
+	res = challengeResponse(parent)
+	res.Devices = ids
+	res.Approvers = reached
+	res.Quorum = req.Required
+	if tx != nil {
+		res.TransactionHash = tx.Hash
+		res.TransactionText = tx.Text
+	}
+	return res, nil
+}
+
+func validateQuorum(userID string, req QuorumChallengeRequest) error {
+	if len(req.Approvers) == 0 || len(req.Approvers) > maxQuorumApprovers || req.Required < 1 || req.Required > len(req.Approvers) {
+		return InvalidInput("invalid_quorum")
+	}
+	seen := make(map[string]bool, len(req.Approvers))
+	for _, a := range req.Approvers {
+		if a == "" || seen[a] {
+			return InvalidInput("invalid_quorum")
+		}
+		if a == userID {
+			return InvalidInput("requester_cannot_approve")
+		}
+		seen[a] = true
+	}
+	return nil
+}
+
+// quorumDevices returns the push devices a quorum challenge reaches
+// approver on, none when they have no usable one. TOTP devices are left
+// out, as a code cannot be entered on the approver's behalf.
+func (s *MFAService) quorumDevices(ctx context.Context, tenantID domain.TenantID, approver string, pol *domain.TenantPolicy) ([]*domain.MFADevice, error) {
+	u, err := s.Users.GetByID(ctx, tenantID, approver)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, InvalidInput("unknown_approver")
+	}
+	devices, err := s.challengeDevices(ctx, tenantID, approver, "", pol)
+	if err == nil {
+		devices = slices.DeleteFunc(devices, isTOTP)
+		if len(devices) > 0 {
+			err = s.checkChallengeLimits(ctx, devices)
+		}
+	}
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		s.logger().Info("quorum_approver_unreachable", "tenant_id", tenantID, "user_id", approver, "error", err)
+		return nil, nil
+	}
+	return devices, err
+}
+
+// settleQuorum carries an answer on member across the quorum challenge
+// parent. An approver's answer cancels their other devices' challenges, and
+// parent is decided once the tally allows.
+func (s *MFAService) settleQuorum(ctx context.Context, parent, member *domain.MFAChallenge, state string, members []*domain.MFAChallenge) error {
+	if decisive(state) {
+		var same []*domain.MFAChallenge
+		for _, m := range members {
+			if m.UserID == member.UserID && m.ID != member.ID {
+				same = append(same, m)
+			}
+		}
+		if err := s.cancelMembers(ctx, same); err != nil {
+			return err
+		}
+	}
+	outcome := tallyQuorum(parent.Quorum, members).outcome()
+	if outcome == "" {
+		return nil
+	}
+	closed, err := s.Challenges.Close(ctx, parent.TenantID, parent.ID, outcome)
+	if err != nil || !closed {
+		return err
+	}
+	s.challengeChanged(ctx, parent.TenantID, parent.UserID, parent.ID, outcome)
+	return s.cancelMembers(ctx, members)
+}
+
+// QuorumStatus tallies the answers to quorum challenge c so far.
+func (s *MFAService) QuorumStatus(ctx context.Context, c *domain.MFAChallenge) (*QuorumTally, error) {
+	members, err := s.Challenges.ListByParent(ctx, c.TenantID, c.ID)
+	if err != nil {
+		return nil, err
+	}
+	return tallyQuorum(c.Quorum, members), nil
+}
+
+// tallyQuorum counts each approver once: approved or denied by the first
+// of their devices to answer, pending while any of them is open.
+func tallyQuorum(required int, members []*domain.MFAChallenge) *QuorumTally {
+	votes := make(map[string]*domain.MFAChallenge)
+	for _, m := range members {
+		if prev, ok := votes[m.UserID]; !ok || voteRank(m) > voteRank(prev) {
+			votes[m.UserID] = m
+		}
+	}
+	t := &QuorumTally{Required: required}
+	for userID, m := range votes {
+		switch {
+		case m.State == domain.ChallengeStateApproved:
+			t.Approved++
+		case m.State == domain.ChallengeStateDenied:
+			t.Denied++
+		case m.Open():
+			t.Pending++
+		}
+		t.Approvers = append(t.Approvers, QuorumVote{UserID: userID, State: m.State})
+	}
+	sort.Slice(t.Approvers, func(i, j int) bool { return t.Approvers[i].UserID < t.Approvers[j].UserID })
+	return t
+}
+
+// voteRank orders an approver's challenges by how much they say about the
+// approver's answer: an answer, then a challenge still open, then one that
+// lapsed or was withdrawn.
+func voteRank(m *domain.MFAChallenge) int {
+	switch {
+	case decisive(m.State):
+		return 2
+	case m.Open():
+		return 1
+	}
+	return 0
+}
+
+// outcome returns the state the tally decides the challenge in, or "" while
+// it is still open.
+func (t *QuorumTally) outcome() string {
+	switch {
+	case t.Approved >= t.Required:
+		return domain.ChallengeStateApproved
+	case t.Approved+t.Pending < t.Required:
+		return domain.ChallengeStateDenied
+	}
+	return ""
+}
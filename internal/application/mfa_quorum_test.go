@@ -0,0 +1,199 @@
+package application
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"trustpin_integration/internal/domain"
+)
+
+func quorumMember(id, userID, state string) *domain.MFAChallenge {
+	return &domain.MFAChallenge{ID: id, TenantID: "t", UserID: userID, DeviceID: id, State: state, ParentID: "q"}
+}
+
+func TestTallyQuorum(t *testing.T) {
+	const (
+		open     = domain.ChallengeStatePushSent
+		approved = domain.ChallengeStateApproved
+		denied   = domain.ChallengeStateDenied
+	)
+	tests := []struct {
+		name    string
+		members []*domain.MFAChallenge
+		want    string
+		counts  [3]int // approved, denied, pending
+	}{
+		{
+			name:    "all pending",
+			members: []*domain.MFAChallenge{quorumMember("a1", "a", open), quorumMember("b1", "b", open), quorumMember("c1", "c", open)},
+			counts:  [3]int{0, 0, 3},
+		},
+		{
+			name:    "threshold reached",
+			members: []*domain.MFAChallenge{quorumMember("a1", "a", approved), quorumMember("b1", "b", approved), quorumMember("c1", "c", open)},
+			want:    approved,
+			counts:  [3]int{2, 0, 1},
+		},
+		{
+			name:    "one short",
+			members: []*domain.MFAChallenge{quorumMember("a1", "a", approved), quorumMember("b1", "b", denied), quorumMember("c1", "c", open)},
+			counts:  [3]int{1, 1, 1},
+		},
+		{
+			name:    "denials make it unreachable",
+			members: []*domain.MFAChallenge{quorumMember("a1", "a", open), quorumMember("b1", "b", denied), quorumMember("c1", "c", denied)},
+			want:    denied,
+			counts:  [3]int{0, 2, 1},
+		},
+		{
+			name:    "lapsed approvers make it unreachable",
+			members: []*domain.MFAChallenge{quorumMember("a1", "a", approved), quorumMember("b1", "b", domain.ChallengeStateExpired), quorumMember("c1", "c", domain.ChallengeStateCancelled)},
+			want:    denied,
+			counts:  [3]int{1, 0, 0},
+		},
+		{
+			name: "each approver counts once",
+			members: []*domain.MFAChallenge{
+				quorumMember("a1", "a", approved), quorumMember("a2", "a", domain.ChallengeStateCancelled),
+				quorumMember("b1", "b", open), quorumMember("b2", "b", denied),
+				quorumMember("c1", "c", open),
+			},
+			counts: [3]int{1, 1, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tallyQuorum(2, tt.members)
+			if c := [3]int{got.Approved, got.Denied, got.Pending}; c != tt.counts {
+				t.Errorf("approved, denied, pending = %v, want %v", c, tt.counts)
+			}
+			if o := got.outcome(); o != tt.want {
+				t.Errorf("outcome = %q, want %q", o, tt.want)
+			}
+			if len(got.Approvers) != 3 {
+				t.Errorf("%d approvers, want 3", len(got.Approvers))
+			}
+		})
+	}
+}
+
+func TestSettleQuorum(t *testing.T) {
+	ctx := context.Background()
+	setup := func() (*MFAService, *challengeMap, *domain.MFAChallenge) {
+		repo := &challengeMap{}
+		parent := &domain.MFAChallenge{ID: "q", TenantID: "t", UserID: "admin", State: domain.ChallengeStatePushSent, Quorum: 2}
+		repo.add(parent)
+		repo.add(quorumMember("a1", "a", domain.ChallengeStatePushSent))
+		repo.add(quorumMember("a2", "a", domain.ChallengeStatePushSent))
+		repo.add(quorumMember("b1", "b", domain.ChallengeStatePushSent))
+		repo.add(quorumMember("c1", "c", domain.ChallengeStatePushSent))
+		return &MFAService{Challenges: repo}, repo, parent
+	}
+	answer := func(t *testing.T, s *MFAService, repo *challengeMap, parent *domain.MFAChallenge, id, state string) {
+		t.Helper()
+		repo.byID[id].State = state
+		members, _ := repo.ListByParent(ctx, "t", parent.ID)
+		if err := s.settleQuorum(ctx, parent, repo.byID[id], state, members); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("approved at threshold", func(t *testing.T) {
+		s, repo, parent := setup()
+		answer(t, s, repo, parent, "a1", domain.ChallengeStateApproved)
+		if got := repo.byID["a2"].State; got != domain.ChallengeStateCancelled {
+			t.Errorf("approver's other device %s, want CANCELLED", got)
+		}
+		if got := repo.byID["q"].State; got != domain.ChallengeStatePushSent {
+			t.Fatalf("quorum %s after one approval", got)
+		}
+		answer(t, s, repo, parent, "b1", domain.ChallengeStateApproved)
+		if got := repo.byID["q"].State; got != domain.ChallengeStateApproved {
+			t.Errorf("quorum %s, want APPROVED", got)
+		}
+		if got := repo.byID["c1"].State; got != domain.ChallengeStateCancelled {
+			t.Errorf("remaining approver %s, want CANCELLED", got)
+		}
+	})
+
+	t.Run("denied once unreachable", func(t *testing.T) {
+		s, repo, parent := setup()
+		answer(t, s, repo, parent, "b1", domain.ChallengeStateDenied)
+		if got := repo.byID["q"].State; got != domain.ChallengeStatePushSent {
+			t.Fatalf("quorum %s after one denial", got)
+		}
+		answer(t, s, repo, parent, "c1", domain.ChallengeStateDenied)
+		if got := repo.byID["q"].State; got != domain.ChallengeStateDenied {
+			t.Errorf("quorum %s, want DENIED", got)
+		}
+		for _, id := range []string{"a1", "a2"} {
+			if got := repo.byID[id].State; got != domain.ChallengeStateCancelled {
+				t.Errorf("%s %s, want CANCELLED", id, got)
+			}
+		}
+	})
+}
+
+// challengeMap is a ChallengeRepository over a map.
+type challengeMap struct {
+	byID map[string]*domain.MFAChallenge
+}
+
+func (r *challengeMap) add(c *domain.MFAChallenge) {
+	if r.byID == nil {
+		r.byID = make(map[string]*domain.MFAChallenge)
+	}
+	r.byID[c.ID] = c
+}
+
+func (r *challengeMap) Create(ctx context.Context, c *domain.MFAChallenge) error {
+	r.add(c)
+	return nil
+}
+
+func (r *challengeMap) GetByID(ctx context.Context, tenantID domain.TenantID, id string) (*domain.MFAChallenge, error) {
+	return r.byID[id], nil
+}
+
+func (r *challengeMap) UpdateState(ctx context.Context, tenantID domain.TenantID, id, state string) error {
+	r.byID[id].State = state
+	return nil
+}
+
+func (r *challengeMap) ListByDevice(ctx context.Context, tenantID domain.TenantID, deviceID string) ([]*domain.MFAChallenge, error) {
+	var out []*domain.MFAChallenge
+	for _, c := range r.byID {
+		if c.DeviceID == deviceID {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+func (r *challengeMap) ListByParent(ctx context.Context, tenantID domain.TenantID, parentID string) ([]*domain.MFAChallenge, error) {
+	var out []*domain.MFAChallenge
+	for _, c := range r.byID {
+		if c.ParentID == parentID {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+func (r *challengeMap) Close(ctx context.Context, tenantID domain.TenantID, id, state string) (bool, error) {
+	c := r.byID[id]
+	if !c.Open() {
+		return false, nil
+	}
+	c.State = state
+	return true, nil
+}
+
+func (r *challengeMap) ListOpenByUser(ctx context.Context, tenantID domain.TenantID, userID string, now time.Time) ([]*domain.MFAChallenge, error) {
+	return nil, nil
+}
+
+func (r *challengeMap) ExpireOpen(ctx context.Context, now time.Time) ([]*domain.MFAChallenge, error) {
+	return nil, nil
+}
@@ -0,0 +1,174 @@
+package application
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"trustpin_integration/internal/domain"
+)
+
+// recoveryCodeCount codes are issued per set. Each carries 40 random bits,
+// shown as two groups of four base32 characters.
+const (
+	recoveryCodeCount = 10
+	recoveryCodeBytes = 5
+)
+
+// Audit event types.
+const (
+	auditRecoveryCodesGenerated      = "mfa.recovery_codes.generated"
+	auditRecoveryCodesGenerateFailed = "mfa.recovery_codes.generate_failed"
+	auditRecoveryCodeRedeemed        = "mfa.recovery_code.redeemed"
+	auditRecoveryCodeRejected        = "mfa.recovery_code.rejected"
+)
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type RecoveryCodesResponse struct {
+	Codes []string `json:"codes"`
+}
+
+// GenerateRecoveryCodes issues a fresh set of recovery codes for the user and
+// invalidates any earlier set. The plain codes are returned once.
+func (s *MFAService) GenerateRecoveryCodes(ctx context.Context, tenantID domain.TenantID, userID string) (_ *RecoveryCodesResponse, err error) {
+	defer func() {
+		s.auditResult(ctx, tenantID, userID, auditAction{Failed: auditRecoveryCodesGenerateFailed}, err, nil)
+	}()
+	now := time.Now()
+	plain := make([]string, 0, recoveryCodeCount)
+	codes := make([]*domain.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		plain = append(plain, code)
+		codes = append(codes, &domain.RecoveryCode{
+			ID:        newID(),
+			TenantID:  tenantID,
+			UserID:    userID,
+			CodeHash:  hashRecoveryCode(code),
+			CreatedAt: now,
+		})
+	}
+
+	err = s.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.RecoveryCodes.ReplaceForUser(ctx, tenantID, userID, codes); err != nil {
+			return err
+		}
+		return s.audit(ctx, tenantID, userID, auditRecoveryCodesGenerated, map[string]any{"count": len(codes)})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &RecoveryCodesResponse{Codes: plain}, nil
+}
+
+// RedeemRecoveryCode satisfies one of the user's open challenges with a
+// recovery code instead of the device it was sent to. The code is spent
+// whether or not the caller goes on to enroll a new device. Quorum and
+// transaction-signing challenges are refused. Refused redemptions are
+// audited with the reason.
+func (s *MFAService) RedeemRecoveryCode(ctx context.Context, tenantID domain.TenantID, userID, challengeID, code string) (_ *TrustPinApproveResponse, err error) {
+	defer func() {
+		s.auditResult(ctx, tenantID, userID, auditAction{Failed: auditRecoveryCodeRejected}, err, map[string]any{"challenge_id": challengeID})
+	}()
+	c, err := s.Challenges.GetByID(ctx, tenantID, challengeID)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil || c.UserID != userID {
+		return nil, NotFound("challenge", challengeID)
+	}
+	if !c.Open() {
+		return nil, InvalidState("challenge", c.ID, c.State)
+	}
+	now := time.Now()
+	if now.After(c.ExpiresAt) {
+		return nil, Expired("challenge", c.ID)
+	}
+	if c.TransactionHash != "" {
+		// A recovery code signs nothing, so it cannot commit to the
+		// transaction the challenge was created for.
+		return nil, Forbidden("transaction_signing_unsupported")
+	}
+	// A quorum needs other users' approvals, which the requester's own
+	// code cannot stand in for; nor can an approver's for their part.
+	quorum, err := s.inQuorum(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if quorum {
+		return nil, Forbidden("quorum_recovery_unsupported")
+	}
+
+	err = s.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		ok, err := s.RecoveryCodes.Consume(ctx, tenantID, userID, hashRecoveryCode(code), now)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return Forbidden("invalid_recovery_code")
+		}
+		// Another answer may have settled the challenge since it was read.
+		closed, err := s.Challenges.Close(ctx, tenantID, c.ID, domain.ChallengeStateApproved)
+		if err != nil {
+			return err
+		}
+		if !closed {
+			return Conflict("challenge_settled", "challenge", c.ID)
+		}
+		if err := s.audit(ctx, tenantID, userID, auditRecoveryCodeRedeemed, map[string]any{"challenge_id": c.ID}); err != nil {
+			return err
+		}
+		s.challengeChanged(ctx, tenantID, userID, c.ID, domain.ChallengeStateApproved)
+		// Redeeming for a fan-out or one of its devices settles the rest of
+		// it along with the challenge.
+		return s.settleFanOutErr(ctx, tenantID, c.ID, domain.ChallengeStateApproved)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.recordOutcome(ctx, tenantID, userID, domain.ChallengeStateApproved)
+	return &TrustPinApproveResponse{ChallengeID: c.ID, Status: domain.ChallengeStateApproved}, nil
+}
+
+// inQuorum reports whether c is a quorum challenge or an approver's part of
+// one.
+func (s *MFAService) inQuorum(ctx context.Context, c *domain.MFAChallenge) (bool, error) {
+	if c.Quorum > 0 || c.ParentID == "" {
+		return c.Quorum > 0, nil
+	}
+	parent, err := s.Challenges.GetByID(ctx, c.TenantID, c.ParentID)
+	if err != nil || parent == nil {
+		return false, err
+	}
+	return parent.Quorum > 0, nil
+}
+
+func newRecoveryCode() (string, error) {
+	buf := make([]byte, recoveryCodeBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(recoveryEncoding.EncodeToString(buf))
+	return code[:4] + "-" + code[4:], nil
+}
+
+// hashRecoveryCode hashes the code as the user would type it, ignoring case,
+// spaces and dashes.
+func hashRecoveryCode(code string) string {
+	normalized := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -2,135 +2,516 @@ package application
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"log/slog"
 	"time"
 
 	"trustpin_integration/internal/domain"
 )
 
+// defaultPairingTTL applies when neither the service nor Trustpin says how
+// long a pairing code stays valid.
+const defaultPairingTTL = 10 * time.Minute
+
+// approveWaitTimeout bounds how long Approve waits for the outbox to deliver
+// the approval before answering that it is still pending.
+const approveWaitTimeout = 10 * time.Second
+
 type MFAService struct {
-	Devices     DeviceRepository
-	Challenges  ChallengeRepository
-	NonceStore  NonceStore
-	IdemStore   IdempotencyStore
-	TrustPin    TrustPinAdapter
+	Devices       DeviceRepository
+	Challenges    ChallengeRepository
+	Transactions  MFATransactionRepository
+	RecoveryCodes RecoveryCodeRepository
+	Audit         AuditRepository
+	NonceStore    NonceStore
+	IdemStore     IdempotencyStore
+	Providers     *ProviderRegistry
+	Tx            TxManager
+	Outbox        *OutboxDispatcher
+	Secrets       SecretCipher
+	TOTPIssuer    string
+	TOTPSkew      int
+	NumberMatch   NumberMatchPolicy
+	Counters      CounterStore
+	Limits        ChallengeLimits
+	TenantLimits  map[domain.TenantID]ChallengeLimits
+	PairingTTL    time.Duration
+	Log           *slog.Logger
+	// Events, when set, tells clients waiting on a challenge that it
+	// changed state.
+	Events *ChallengeBroker
+	// Risk, when set, scores each new challenge and decides whether it
+	// needs MFA at all, a push with or without number matching, or is
+	// refused.
+	Risk *RiskEngine
+	// Policies resolves each tenant's MFA policy; without it the built-in
+	// defaults apply.
+	Policies *PolicyService
+	// History, when set, records every state a challenge goes through.
+	History ChallengeHistoryRepository
+	// Users resolves roles for the admin views of challenges.
+	Users UserRepository
+	// PairingLinkBase is the deep link the Trustpin app opens to pair; the
+	// pairing code, tenant and expiry are added as query parameters.
+	PairingLinkBase string
 }
 
-func (s *MFAService) Enroll(ctx context.Context, tenantID domain.TenantID, userID string, req TrustPinEnrollRequest) (*TrustPinEnrollResponse, error) {
-	d := &domain.MFADevice{
-		ID:         req.DeviceID,
-		TenantID:   tenantID,
-		UserID:     userID,
-		DeviceName: "",
-		PublicKey:  "",
-		State:      "PENDING",
-		CreatedAt:  time.Now(),
-		UpdatedAt:  time.Now(),
+// Enroll creates the local device and starts pairing at Trustpin. The steps
+// run as a saga: the device state records how far the flow got, and a
+// failure undoes the completed steps so the same device_id can be retried.
+func (s *MFAService) Enroll(ctx context.Context, tenantID domain.TenantID, userID string, req TrustPinEnrollRequest) (_ *TrustPinEnrollResponse, err error) {
+	defer func() {
+		s.auditResult(ctx, tenantID, userID, auditDeviceEnroll, err, map[string]any{"device_id": req.DeviceID, "type": domain.DeviceTypeTrustPin})
+	}()
+	if err := s.checkEnrollPolicy(ctx, tenantID, userID, req.DeviceID, domain.DeviceTypeTrustPin); err != nil {
+		return nil, err
 	}
-	if err := s.Devices.Create(ctx, d); err != nil {
+	p, err := s.pairingProvider(ctx, tenantID, domain.DeviceTypeTrustPin)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.reserveDeviceID(ctx, tenantID, userID, req.DeviceID); err != nil {
 		return nil, err
 	}
 
-	res, err := s.TrustPin.Enroll(ctx, req)
+	now := time.Now()
+	d := &domain.MFADevice{
+		ID:               req.DeviceID,
+		TenantID:         tenantID,
+		UserID:           userID,
+		Type:             domain.DeviceTypeTrustPin,
+		DeviceName:       "",
+		PublicKey:        "",
+		State:            domain.DeviceStatePending,
+		PairingExpiresAt: now.Add(s.pairingTTL()),
+		CreatedAt:        now,
+		UpdatedAt:        now,
+		Provider:         p.Name(),
+	}
+	var res *TrustPinEnrollResponse
+	sg := newSaga("enroll")
+
+	err = sg.step(ctx, "create_device", func(ctx context.Context) error {
+		return s.Devices.Create(ctx, d)
+	}, func(ctx context.Context) error {
+		return s.Devices.Delete(ctx, tenantID, d.ID)
+	})
 	if err != nil {
 		return nil, err
 	}
-	if err := s.Devices.UpdateState(ctx, tenantID, d.ID, "PAIRING_PENDING"); err != nil {
-		return nil, err
+
+	err = sg.step(ctx, "trustpin_enroll", func(ctx context.Context) error {
+		var err error
+		res, err = p.Enroll(ctx, req)
+		return err
+	}, func(ctx context.Context) error {
+		return s.cancelEnrollment(ctx, tenantID, p.Name(), res.EnrollmentID)
+	})
+	if err != nil {
+		return nil, s.abortSaga(ctx, sg, err)
+	}
+
+	err = sg.step(ctx, "mark_pairing_pending", func(ctx context.Context) error {
+		d.TrustPinEnrollID = res.EnrollmentID
+		d.State = domain.DeviceStatePairingPending
+		if exp, err := time.Parse(time.RFC3339, res.ExpiresAt); err == nil {
+			d.PairingExpiresAt = exp
+		}
+		if s.Secrets != nil && res.PairingCode != "" {
+			sealed, err := s.Secrets.Seal([]byte(res.PairingCode))
+			if err != nil {
+				return err
+			}
+			d.PairingCode = sealed
+		}
+		return s.Devices.Update(ctx, d)
+	}, nil)
+	if err != nil {
+		return nil, s.abortSaga(ctx, sg, err)
 	}
 	return res, nil
 }
 
-func (s *MFAService) Activate(ctx context.Context, tenantID domain.TenantID, userID string, req TrustPinActivateRequest) (*TrustPinActivateResponse, error) {
-	d, err := s.Devices.GetByID(ctx, tenantID, req.DeviceID)
+// Activate completes pairing at Trustpin and records the device metadata.
+// If the local update fails after Trustpin activated the device, the remote
+// device is revoked again so it cannot be challenged without a local record.
+func (s *MFAService) Activate(ctx context.Context, tenantID domain.TenantID, userID string, req TrustPinActivateRequest) (_ *TrustPinActivateResponse, err error) {
+	defer func() {
+		s.auditResult(ctx, tenantID, userID, auditDeviceActivate, err, map[string]any{"device_id": req.DeviceID})
+	}()
+	d, err := s.FindDevice(ctx, tenantID, req.DeviceID)
 	if err != nil {
 		return nil, err
 	}
-	if d == nil || d.State != "PAIRING_PENDING" {
-		return nil, errors.New("invalid_state")
+	if d == nil {
+		return nil, InvalidState("device", req.DeviceID, "")
 	}
-
-	res, err := s.TrustPin.Activate(ctx, req)
+	if d.State != domain.DeviceStatePairingPending || isTOTP(d) {
+		return nil, InvalidState("device", d.ID, d.State)
+	}
+	fp, err := s.deviceProvider(ctx, d)
 	if err != nil {
 		return nil, err
 	}
-	if err := s.Devices.UpdateState(ctx, tenantID, d.ID, "ACTIVE"); err != nil {
+	p, ok := fp.(PairingProvider)
+	if !ok {
+		return nil, InvalidState("device", d.ID, d.State)
+	}
+
+	var res *TrustPinActivateResponse
+	sg := newSaga("activate")
+
+	err = sg.step(ctx, "trustpin_activate", func(ctx context.Context) error {
+		var err error
+		res, err = p.Activate(ctx, req)
+		return err
+	}, func(ctx context.Context) error {
+		remoteID := res.DeviceID
+		if remoteID == "" {
+			remoteID = d.ID
+		}
+		_, err := s.Outbox.Enqueue(ctx, tenantID, opTrustPinRevokeDevice, "revoke_device:"+d.ID+":"+d.TrustPinEnrollID, TrustPinRevokeRequest{
+			TenantID: string(tenantID),
+			UserID:   userID,
+			DeviceID: remoteID,
+			Provider: p.Name(),
+		})
+		s.Outbox.Notify()
+		return err
+	})
+	if err != nil {
 		return nil, err
 	}
-	if res.DeviceID != "" && res.DeviceID != req.DeviceID {
-		alias := &domain.MFADevice{
-			ID:         res.DeviceID,
-			TenantID:   tenantID,
-			UserID:     userID,
-			DeviceName: d.DeviceName,
-			PublicKey:  d.PublicKey,
-			State:      "ACTIVE",
-			CreatedAt:  d.CreatedAt,
-			UpdatedAt:  time.Now(),
+
+	err = sg.step(ctx, "mark_active", func(ctx context.Context) error {
+		updated := *d
+		updated.DeviceName = req.Label
+		updated.PublicKey = req.PublicKey
+		updated.TrustPinDeviceID = res.DeviceID
+		if updated.TrustPinDeviceID == "" {
+			updated.TrustPinDeviceID = d.ID
+		}
+		updated.State = domain.DeviceStateActive
+		updated.PairingCode = ""
+		return s.Devices.Update(ctx, &updated)
+	}, nil)
+	if err != nil {
+		return nil, s.abortSaga(ctx, sg, err)
+	}
+	return res, nil
+}
+
+// CreateChallenge asks the user to confirm action on req.DeviceID. Without
+// a device ID the challenge goes to the user's primary device or, if they
+// have none, to all of their active push devices as one fan-out challenge.
+func (s *MFAService) CreateChallenge(ctx context.Context, tenantID domain.TenantID, userID string, req TrustPinChallengeRequest) (res *TrustPinChallengeResponse, err error) {
+	var (
+		risk     RiskAssessment
+		tx       *signedTransaction
+		failover string
+	)
+	defer func() {
+		payload := map[string]any{"device_id": req.DeviceID, "action": req.Action}
+		if res != nil {
+			payload["challenge_id"] = res.ChallengeID
+			if len(res.Devices) > 0 {
+				payload["devices"] = res.Devices
+			}
+		}
+		if tx != nil {
+			payload["transaction_hash"] = tx.Hash
 		}
-		if err := s.Devices.Create(ctx, alias); err != nil && err.Error() != "device_exists" {
+		if failover != "" {
+			payload["failover_provider"] = failover
+		}
+		if risk.Decision != "" {
+			payload["risk_score"] = risk.Score
+			payload["risk_rules"] = risk.Rules
+			payload["risk_decision"] = risk.Decision
+		}
+		s.auditResult(ctx, tenantID, userID, auditChallengeCreate, err, payload)
+	}()
+	if tx, err = declaredTransaction(req.Context); err != nil {
+		return nil, err
+	}
+	pol, err := s.policy(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	devices, err := s.challengeDevices(ctx, tenantID, userID, req.DeviceID, pol)
+	if err != nil {
+		return nil, err
+	}
+	if tx != nil && isTOTP(devices[0]) {
+		// A TOTP code cannot show or commit to the transaction.
+		return nil, Forbidden("transaction_signing_unsupported")
+	}
+	if err := s.checkChallengeLimits(ctx, devices); err != nil {
+		return nil, err
+	}
+	if risk, err = s.assessRisk(ctx, youngestDevice(devices), req); err != nil {
+		return nil, err
+	}
+	if tx != nil && risk.Decision == domain.RiskDecisionAllow {
+		// A transaction is only bound by the device signing it, so a low
+		// score still sends the push.
+		risk.Decision = domain.RiskDecisionPush
+	}
+	c := newChallenge(devices[0], req.Action, pol.ChallengeTTL, risk)
+	if len(devices) > 1 {
+		c.DeviceID = ""
+	}
+	if tx != nil {
+		c.TransactionHash = tx.Hash
+		c.TransactionText = tx.Text
+		req.Context = withTransaction(req.Context, tx)
+	}
+	switch risk.Decision {
+	case domain.RiskDecisionAllow, domain.RiskDecisionDeny:
+		return s.settleByRisk(ctx, c)
+	}
+
+	var number string
+	if !isTOTP(devices[0]) && (s.NumberMatch.Required(tenantID, req.Action) || risk.Decision == domain.RiskDecisionPushNumberMatch) {
+		if number, err = newMatchNumber(); err != nil {
 			return nil, err
 		}
 	}
+	if len(devices) > 1 {
+		res, err = s.createFanOut(ctx, c, devices, req, number)
+	} else {
+		res, err = s.createSingle(ctx, c, devices[0], req, number)
+	}
+	if providerUnavailable(err) {
+		res, failover, err = s.failover(ctx, c, deviceType(devices[0]), req, number, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tx != nil {
+		res.TransactionHash = tx.Hash
+		res.TransactionText = tx.Text
+	}
 	return res, nil
 }
 
-func (s *MFAService) CreateChallenge(ctx context.Context, tenantID domain.TenantID, userID string, req TrustPinChallengeRequest) (*TrustPinChallengeResponse, error) {
-	d, err := s.Devices.GetByID(ctx, tenantID, req.DeviceID)
+// createSingle sends c to device d alone and stores it.
+func (s *MFAService) createSingle(ctx context.Context, c *domain.MFAChallenge, d *domain.MFADevice, req TrustPinChallengeRequest, number string) (*TrustPinChallengeResponse, error) {
+	res, err := s.sendChallenge(ctx, d, req, number)
 	if err != nil {
 		return nil, err
 	}
-	if d == nil || d.State != "ACTIVE" {
-		return nil, errors.New("invalid_state")
+	c.State = res.State
+	c.NumberMatch = number
+	if res.ChallengeID == "" {
+		// A local provider keeps the challenge's own ID and times.
+		res = challengeResponse(c)
+		res.NumberMatch = number
+	} else {
+		c.ID = res.ChallengeID
+		c.TrustPinChallengeID = res.ChallengeID
+	}
+	if err := s.createChallenge(ctx, c); err != nil {
+		return nil, err
 	}
+	return res, nil
+}
 
-	res, err := s.TrustPin.CreateChallenge(ctx, req)
+// sendChallenge sends the challenge to device d through its provider, with
+// number for the user to pick when number matching applies.
+func (s *MFAService) sendChallenge(ctx context.Context, d *domain.MFADevice, req TrustPinChallengeRequest, number string) (*TrustPinChallengeResponse, error) {
+	p, err := s.deviceProvider(ctx, d)
 	if err != nil {
 		return nil, err
 	}
-
-	c := &domain.MFAChallenge{
-		ID:                 res.ChallengeID,
-		TenantID:           tenantID,
-		UserID:             userID,
-		DeviceID:           req.DeviceID,
-		Action:             req.Action,
-		State:              res.State,
-		IssuedAt:           time.Now(),
-		ExpiresAt:          time.Now().Add(2 * time.Minute),
-		UpdatedAt:          time.Now(),
-		TrustPinChallengeID: res.ChallengeID,
+	req.DeviceID = trustPinDeviceID(d)
+	if number != "" {
+		reqCtx := make(map[string]any, len(req.Context)+1)
+		for k, v := range req.Context {
+			reqCtx[k] = v
+		}
+		reqCtx[numberMatchKey] = number
+		req.Context = reqCtx
 	}
-	if err := s.Challenges.Create(ctx, c); err != nil {
+	res, err := p.CreateChallenge(ctx, req)
+	if err != nil {
 		return nil, err
 	}
+	res.NumberMatch = number
 	return res, nil
 }
 
-func (s *MFAService) Approve(ctx context.Context, tenantID domain.TenantID, userID string, req TrustPinApproveRequest) (*TrustPinApproveResponse, error) {
+func (s *MFAService) Approve(ctx context.Context, tenantID domain.TenantID, userID string, req TrustPinApproveRequest) (res *TrustPinApproveResponse, err error) {
+	defer func() {
+		payload := map[string]any{"challenge_id": req.ChallengeID}
+		if res != nil {
+			payload["status"] = res.Status
+		}
+		s.auditResult(ctx, tenantID, userID, auditChallengeApprove, err, payload)
+	}()
 	c, err := s.Challenges.GetByID(ctx, tenantID, req.ChallengeID)
 	if err != nil {
 		return nil, err
 	}
-	if c == nil || c.State != "PUSH_SENT" {
-		return nil, errors.New("invalid_state")
+	if c == nil {
+		return nil, InvalidState("challenge", req.ChallengeID, "")
 	}
-	if nonce, ok := extractNonce(req.Payload); ok {
-		if okSet, err := s.NonceStore.CheckAndSet(ctx, tenantID, nonce, time.Minute*5); err != nil || !okSet {
-			return nil, errors.New("nonce_reuse")
+	if isFanOut(c) {
+		// Approving the logical challenge answers it for req.DeviceID.
+		if c, err = s.fanOutMember(ctx, c, userID, req.DeviceID); err != nil {
+			return nil, err
 		}
-	} else {
-		return nil, errors.New("missing_nonce")
+		req.ChallengeID = c.ID
+	}
+	if c.UserID != userID {
+		return nil, NotFound("challenge", req.ChallengeID)
+	}
+	if c.State == domain.ChallengeStateCodeRequired {
+		return s.approveTOTP(ctx, c, req.TOTPCode)
+	}
+	if c.State != domain.ChallengeStatePushSent {
+		return nil, InvalidState("challenge", c.ID, c.State)
+	}
+	if !time.Now().Before(c.ExpiresAt) {
+		// The sweeper has not got to it yet.
+		return nil, Expired("challenge", c.ID)
+	}
+	nonce, ok := extractNonce(req.Payload)
+	if !ok {
+		return nil, InvalidInput("missing_nonce")
+	}
+	pol, err := s.policy(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if okSet, err := s.NonceStore.CheckAndSet(ctx, tenantID, nonce, pol.NonceTTL); err != nil || !okSet {
+		return nil, Conflict("nonce_reuse", "challenge", c.ID)
+	}
+	if c.NumberMatch != "" && payloadNumber(req.Payload) != c.NumberMatch {
+		// Picking the wrong number suggests the user did not start this
+		// sign-in, so the challenge is closed rather than left to guess.
+		if err := s.denyChallenge(ctx, c); err != nil {
+			return nil, err
+		}
+		return nil, Forbidden("number_mismatch")
+	}
+	if c.TransactionHash != "" && payloadTransactionHash(req.Payload) != c.TransactionHash {
+		// The device signed a different transaction than the one the
+		// challenge was created for.
+		if err := s.denyChallenge(ctx, c); err != nil {
+			return nil, err
+		}
+		return nil, Forbidden("transaction_mismatch")
+	}
+
+	d, err := s.ownedDevice(ctx, tenantID, c.UserID, req.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+	if c.DeviceID != "" && d.ID != c.DeviceID {
+		return nil, NotFound("device", req.DeviceID)
 	}
 
-	res, err := s.TrustPin.Approve(ctx, req)
+	p, err := s.deviceProvider(ctx, d)
 	if err != nil {
 		return nil, err
 	}
-	if err := s.Challenges.UpdateState(ctx, tenantID, req.ChallengeID, res.Status); err != nil {
+	req.DeviceID = trustPinDeviceID(d)
+	req.Provider = p.Name()
+	var msg *domain.OutboxMessage
+	err = s.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		msg, err = s.Outbox.Enqueue(ctx, tenantID, opTrustPinApprove, "approve:"+c.ID+":"+nonce, req)
+		return err
+	})
+	if err != nil {
 		return nil, err
 	}
-	return res, nil
+	s.Outbox.Notify()
+
+	waitCtx, cancel := context.WithTimeout(ctx, approveWaitTimeout)
+	defer cancel()
+	msg, err = s.Outbox.Wait(waitCtx, msg.ID)
+	if errors.Is(err, context.DeadlineExceeded) {
+		// The dispatcher keeps retrying; the outcome lands on the challenge.
+		return nil, &Error{Kind: ErrTimeout, Code: "approval_pending", Entity: "challenge", ID: c.ID, Err: err}
+	}
+	if err != nil {
+		return nil, err
+	}
+	var approved TrustPinApproveResponse
+	if err := json.Unmarshal(msg.Result, &approved); err != nil {
+		return nil, err
+	}
+	return &approved, nil
+}
+
+// reserveDeviceID makes deviceID available for a new enrollment. A revoked
+// device, or one whose pairing window has lapsed, may be enrolled again under
+// the same ID by its owner; anything else is still in use.
+func (s *MFAService) reserveDeviceID(ctx context.Context, tenantID domain.TenantID, userID, deviceID string) error {
+	existing, err := s.Devices.GetByID(ctx, tenantID, deviceID)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return nil
+	}
+	if existing.UserID != userID || !(existing.State == domain.DeviceStateRevoked || pairingExpired(existing, time.Now())) {
+		return Conflict("device_exists", "device", deviceID)
+	}
+	return s.discardDevice(ctx, existing)
+}
+
+// FindDevice resolves a device by its local ID or, failing that, by the
+// device ID Trustpin assigned on activation.
+func (s *MFAService) FindDevice(ctx context.Context, tenantID domain.TenantID, id string) (*domain.MFADevice, error) {
+	d, err := s.Devices.GetByID(ctx, tenantID, id)
+	if err != nil || d != nil {
+		return d, err
+	}
+	return s.Devices.GetByTrustPinDeviceID(ctx, tenantID, id)
+}
+
+// newChallenge starts a challenge on d for action that can be answered for
+// ttl. The caller sets its state before storing it.
+func newChallenge(d *domain.MFADevice, action string, ttl time.Duration, risk RiskAssessment) *domain.MFAChallenge {
+	now := time.Now()
+	return &domain.MFAChallenge{
+		ID:           newID(),
+		TenantID:     d.TenantID,
+		UserID:       d.UserID,
+		DeviceID:     d.ID,
+		Action:       action,
+		IssuedAt:     now,
+		ExpiresAt:    now.Add(ttl),
+		UpdatedAt:    now,
+		RiskScore:    risk.Score,
+		RiskRules:    risk.Rules,
+		RiskDecision: risk.Decision,
+	}
+}
+
+func challengeResponse(c *domain.MFAChallenge) *TrustPinChallengeResponse {
+	return &TrustPinChallengeResponse{
+		ChallengeID: c.ID,
+		State:       c.State,
+		IssuedAt:    c.IssuedAt.UTC().Format(time.RFC3339),
+		ExpiresAt:   c.ExpiresAt.UTC().Format(time.RFC3339),
+	}
+}
+
+func isTOTP(d *domain.MFADevice) bool {
+	return d.Type == domain.DeviceTypeTOTP
+}
+
+// trustPinDeviceID returns the identifier Trustpin knows the device by.
+func trustPinDeviceID(d *domain.MFADevice) string {
+	if d.TrustPinDeviceID != "" {
+		return d.TrustPinDeviceID
+	}
+	return d.ID
 }
 
 func extractNonce(payload map[string]any) (string, bool) {
@@ -144,3 +525,25 @@ func extractNonce(payload map[string]any) (string, bool) {
 	}
 	return "", false
 }
+
+func (s *MFAService) abortSaga(ctx context.Context, sg *saga, cause error) error {
+	err := sg.abort(ctx, cause)
+	if err != cause {
+		s.logger().Error("saga_compensation_failed", "saga", sg.name, "error", err)
+	}
+	return err
+}
+
+func (s *MFAService) pairingTTL() time.Duration {
+	if s.PairingTTL > 0 {
+		return s.PairingTTL
+	}
+	return defaultPairingTTL
+}
+
+func (s *MFAService) logger() *slog.Logger {
+	if s.Log != nil {
+		return s.Log
+	}
+	return slog.Default()
+}
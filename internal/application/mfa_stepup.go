@@ -0,0 +1,106 @@
+package application
+
+import (
+	"context"
+	"time"
+
+	"trustpin_integration/internal/domain"
+)
+
+// stepUpWindow is how long after approval a challenge can be exchanged for
+// an elevated token.
+const stepUpWindow = 5 * time.Minute
+
+// Elevation describes the MFA behind an elevated token: the acr, amr and
+// auth_time claims, and the action the challenge approved.
+type Elevation struct {
+	ACR      string
+	AMR      []string
+	AuthTime time.Time
+	Action   string
+}
+
+// StepUp exchanges one of the user's recently approved challenges for the
+// claims of an elevated token. Each challenge can be exchanged once.
+func (s *MFAService) StepUp(ctx context.Context, tenantID domain.TenantID, userID, challengeID string) (_ *Elevation, err error) {
+	defer func() {
+		s.auditResult(ctx, tenantID, userID, auditStepUp, err, map[string]any{"challenge_id": challengeID})
+	}()
+	c, err := s.Challenges.GetByID(ctx, tenantID, challengeID)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil || c.UserID != userID {
+		return nil, NotFound("challenge", challengeID)
+	}
+	if c.ParentID != "" {
+		// A device's part of a fan-out is exchanged as the whole, so one
+		// approval yields one elevation.
+		if c, err = s.Challenges.GetByID(ctx, tenantID, c.ParentID); err != nil {
+			return nil, err
+		}
+		if c == nil {
+			return nil, NotFound("challenge", challengeID)
+		}
+	}
+	if c.Quorum > 0 {
+		// Other users approved it; neither the caller nor an approver
+		// proved a second factor for their own session.
+		return nil, Forbidden("mfa_not_performed")
+	}
+	if c.State != domain.ChallengeStateApproved {
+		return nil, InvalidState("challenge", c.ID, c.State)
+	}
+	if c.RiskDecision == domain.RiskDecisionAllow {
+		// The risk engine waved it through; no second factor was used.
+		return nil, Forbidden("mfa_not_performed")
+	}
+	if time.Since(c.UpdatedAt) > stepUpWindow {
+		return nil, Expired("challenge", c.ID)
+	}
+	fresh, err := s.NonceStore.CheckAndSet(ctx, tenantID, "step_up:"+c.ID, stepUpWindow)
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		return nil, Conflict("challenge_already_exchanged", "challenge", c.ID)
+	}
+	return s.elevation(ctx, c)
+}
+
+// elevation describes the approval of c, by the device that answered it for
+// a fan-out. A challenge the risk engine allowed without MFA adds no factor.
+func (s *MFAService) elevation(ctx context.Context, c *domain.MFAChallenge) (*Elevation, error) {
+	if c.RiskDecision == domain.RiskDecisionAllow {
+		return &Elevation{ACR: domain.ACRPassword, AuthTime: c.UpdatedAt, Action: c.Action}, nil
+	}
+	deviceID := c.DeviceID
+	if isFanOut(c) {
+		subs, err := s.Challenges.ListByParent(ctx, c.TenantID, c.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, sub := range subs {
+			if sub.State == domain.ChallengeStateApproved {
+				deviceID = sub.DeviceID
+				break
+			}
+		}
+	}
+	d, err := s.Devices.GetByID(ctx, c.TenantID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	// RFC 8176 method references: a TOTP code is "otp", a Trustpin approval
+	// is signed with the device's software-held key, "swk".
+	method := "swk"
+	if d != nil && isTOTP(d) {
+		method = "otp"
+	}
+	return &Elevation{
+		ACR:      domain.ACRMultiFactor,
+		AMR:      []string{method, "mfa"},
+		AuthTime: c.UpdatedAt,
+		Action:   c.Action,
+	}, nil
+}
@@ -0,0 +1,160 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"trustpin_integration/internal/domain"
+)
+
+const defaultTOTPIssuer = "Trustpin"
+
+type TOTPEnrollResponse struct {
+	DeviceID   string `json:"device_id"`
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+	ExpiresAt  string `json:"expires_at"`
+}
+
+type TOTPActivateResponse struct {
+	DeviceID string `json:"device_id"`
+	State    string `json:"state"`
+}
+
+// EnrollTOTP provisions a local TOTP device. The secret is returned once, in
+// plain and as an otpauth:// URI, and stored sealed; the device stays
+// PAIRING_PENDING until ActivateTOTP sees a valid code from it.
+func (s *MFAService) EnrollTOTP(ctx context.Context, tenantID domain.TenantID, userID, deviceID, label string) (_ *TOTPEnrollResponse, err error) {
+	defer func() {
+		s.auditResult(ctx, tenantID, userID, auditDeviceEnroll, err, map[string]any{"device_id": deviceID, "type": domain.DeviceTypeTOTP})
+	}()
+	if err := s.checkEnrollPolicy(ctx, tenantID, userID, deviceID, domain.DeviceTypeTOTP); err != nil {
+		return nil, err
+	}
+	if err := s.reserveDeviceID(ctx, tenantID, userID, deviceID); err != nil {
+		return nil, err
+	}
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := s.Secrets.Seal(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	d := &domain.MFADevice{
+		ID:               deviceID,
+		TenantID:         tenantID,
+		UserID:           userID,
+		Type:             domain.DeviceTypeTOTP,
+		DeviceName:       label,
+		Secret:           sealed,
+		State:            domain.DeviceStatePairingPending,
+		PairingExpiresAt: now.Add(s.pairingTTL()),
+		CreatedAt:        now,
+		UpdatedAt:        now,
+		Provider:         TOTPProviderName,
+	}
+	if err := s.Devices.Create(ctx, d); err != nil {
+		return nil, err
+	}
+
+	issuer := s.TOTPIssuer
+	if issuer == "" {
+		issuer = defaultTOTPIssuer
+	}
+	return &TOTPEnrollResponse{
+		DeviceID:   d.ID,
+		Secret:     totpEncoding.EncodeToString(secret),
+		OTPAuthURI: totpURI(issuer, userID, secret),
+		ExpiresAt:  d.PairingExpiresAt.UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// ActivateTOTP confirms the user's authenticator produces valid codes.
+func (s *MFAService) ActivateTOTP(ctx context.Context, tenantID domain.TenantID, userID, deviceID, code string) (_ *TOTPActivateResponse, err error) {
+	defer func() {
+		s.auditResult(ctx, tenantID, userID, auditDeviceActivate, err, map[string]any{"device_id": deviceID})
+	}()
+	d, err := s.ownedDevice(ctx, tenantID, userID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if !isTOTP(d) || d.State != domain.DeviceStatePairingPending {
+		return nil, InvalidState("device", d.ID, d.State)
+	}
+	if pairingExpired(d, time.Now()) {
+		return nil, Expired("device", d.ID)
+	}
+	if err := s.checkTOTP(ctx, d, code); err != nil {
+		return nil, err
+	}
+	if err := s.Devices.UpdateState(ctx, tenantID, d.ID, domain.DeviceStateActive); err != nil {
+		return nil, err
+	}
+	return &TOTPActivateResponse{DeviceID: d.ID, State: domain.DeviceStateActive}, nil
+}
+
+func (s *MFAService) approveTOTP(ctx context.Context, c *domain.MFAChallenge, code string) (*TrustPinApproveResponse, error) {
+	if code == "" {
+		return nil, InvalidInput("missing_totp_code")
+	}
+	if time.Now().After(c.ExpiresAt) {
+		return nil, Expired("challenge", c.ID)
+	}
+	d, err := s.Devices.GetByID(ctx, c.TenantID, c.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		return nil, InvalidState("device", c.DeviceID, "")
+	}
+	p, err := s.deviceProvider(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	res, err := p.Approve(ctx, TrustPinApproveRequest{
+		TenantID:    string(c.TenantID),
+		UserID:      c.UserID,
+		DeviceID:    d.ID,
+		ChallengeID: c.ID,
+		TOTPCode:    code,
+	})
+	if err != nil {
+		return nil, err
+	}
+	closed, err := s.closeChallenge(ctx, c.TenantID, c.UserID, c.ID, res.Status)
+	if err != nil {
+		return nil, err
+	}
+	if !closed {
+		return nil, Conflict("challenge_settled", "challenge", c.ID)
+	}
+	s.recordOutcome(ctx, c.TenantID, c.UserID, res.Status)
+	return res, nil
+}
+
+// checkTOTP verifies code against the device secret and burns the matching
+// time step in the nonce store so the same code cannot be replayed.
+func (s *MFAService) checkTOTP(ctx context.Context, d *domain.MFADevice, code string) error {
+	secret, err := s.Secrets.Open(d.Secret)
+	if err != nil {
+		return err
+	}
+	counter, ok := verifyTOTP(secret, code, time.Now(), s.TOTPSkew)
+	if !ok {
+		return Forbidden("invalid_totp_code")
+	}
+	window := time.Duration(2*s.TOTPSkew+1) * totpPeriod
+	fresh, err := s.NonceStore.CheckAndSet(ctx, d.TenantID, fmt.Sprintf("totp:%s:%d", d.ID, counter), window)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return Conflict("totp_code_reuse", "device", d.ID)
+	}
+	return nil
+}
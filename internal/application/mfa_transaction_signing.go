@@ -0,0 +1,107 @@
+package application
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// Transaction signing binds an approval to the transaction the user saw.
+// transactionKey declares the transaction in the challenge context; the
+// service adds its hash and display text under transactionHashKey and
+// transactionTextKey, and the signed approval payload must carry the same
+// hash under transactionHashKey.
+const (
+	transactionKey     = "transaction"
+	transactionHashKey = "transaction_hash"
+	transactionTextKey = "transaction_text"
+)
+
+// signedTransaction is a transaction declared in a challenge context, in
+// the form the device displays and signs.
+type signedTransaction struct {
+	Hash string
+	Text string
+}
+
+// declaredTransaction reads the transaction declared in a challenge context,
+// if any. It must be an object with an amount, a currency and a payee.
+func declaredTransaction(reqCtx map[string]any) (*signedTransaction, error) {
+	v, ok := reqCtx[transactionKey]
+	if !ok {
+		return nil, nil
+	}
+	tx, ok := v.(map[string]any)
+	if !ok {
+		return nil, InvalidInput("invalid_transaction")
+	}
+	amount, err := transactionAmount(tx["amount"])
+	if err != nil {
+		return nil, err
+	}
+	currency, _ := tx["currency"].(string)
+	payee, _ := tx["payee"].(string)
+	if currency == "" || payee == "" {
+		return nil, InvalidInput("invalid_transaction")
+	}
+	canonical, err := canonicalJSON(tx)
+	if err != nil {
+		return nil, InvalidInput("invalid_transaction")
+	}
+	sum := sha256.Sum256(canonical)
+	return &signedTransaction{
+		Hash: hex.EncodeToString(sum[:]),
+		Text: fmt.Sprintf("Pay %s %s to %s", amount, currency, payee),
+	}, nil
+}
+
+// transactionAmount formats the amount for display. Strings are taken as
+// given so decimal amounts need not pass through a float.
+func transactionAmount(v any) (string, error) {
+	switch a := v.(type) {
+	case string:
+		if a != "" {
+			return a, nil
+		}
+	case float64:
+		b, err := json.Marshal(a)
+		if err == nil {
+			return string(b), nil
+		}
+	}
+	return "", InvalidInput("invalid_transaction")
+}
+
+// canonicalJSON encodes v with object keys sorted, no insignificant
+// whitespace and no HTML escaping, so the same transaction always hashes
+// the same however the client ordered or spaced it.
+func canonicalJSON(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// withTransaction returns a copy of reqCtx carrying the hash and display
+// text of tx for Trustpin to show and have signed.
+func withTransaction(reqCtx map[string]any, tx *signedTransaction) map[string]any {
+	out := make(map[string]any, len(reqCtx)+2)
+	for k, v := range reqCtx {
+		out[k] = v
+	}
+	out[transactionHashKey] = tx.Hash
+	out[transactionTextKey] = tx.Text
+	return out
+}
+
+// payloadTransactionHash extracts the transaction hash from an approval
+// payload.
+func payloadTransactionHash(payload map[string]any) string {
+	h, _ := payload[transactionHashKey].(string)
+	return h
+}
@@ -0,0 +1,42 @@
+package application
+
+import (
+	"context"
+
+	"trustpin_integration/internal/domain"
+)
+
+// TrustPinChallengeResult is the body of a Trustpin webhook reporting how a
+// challenge ended on its side.
+type TrustPinChallengeResult struct {
+	Event       string `json:"event"`
+	TenantID    string `json:"tenant_id"`
+	ChallengeID string `json:"challenge_id"`
+	Status      string `json:"status"`
+}
+
+// ApplyChallengeResult records a challenge outcome reported by Trustpin.
+// Webhooks may be repeated or arrive after the challenge was settled here,
+// so results for challenges that are no longer open are ignored.
+func (s *MFAService) ApplyChallengeResult(ctx context.Context, res TrustPinChallengeResult) error {
+	switch res.Status {
+	case domain.ChallengeStateApproved, domain.ChallengeStateDenied, domain.ChallengeStateExpired:
+	default:
+		return InvalidInput("invalid_status")
+	}
+	tenantID := domain.TenantID(res.TenantID)
+	ctx = withActor(ctx, domain.ChallengeActorWebhook, RequestMetaFrom(ctx).RequestID)
+	c, err := s.Challenges.GetByID(ctx, tenantID, res.ChallengeID)
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		return NotFound("challenge", res.ChallengeID)
+	}
+	closed, err := s.closeChallenge(ctx, tenantID, c.UserID, c.ID, res.Status)
+	if err != nil || !closed {
+		return err
+	}
+	s.recordOutcome(ctx, tenantID, c.UserID, res.Status)
+	return nil
+}
@@ -0,0 +1,311 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"trustpin_integration/internal/domain"
+)
+
+const (
+	defaultOutboxMaxAttempts = 8
+	defaultOutboxBackoff     = time.Second
+	maxOutboxBackoff         = 5 * time.Minute
+	defaultOutboxBatchSize   = 50
+	outboxLease              = 30 * time.Second
+)
+
+// OutboxHandler delivers one message and returns the result to store on it.
+// Errors are retried unless they report Temporary() == false, as
+// UpstreamError does for client-side (4xx) failures.
+type OutboxHandler func(ctx context.Context, m *domain.OutboxMessage) ([]byte, error)
+
+// OutboxDispatcher delivers outbox messages with retries. Operations are
+// recorded with Enqueue inside the caller's transaction; after the commit the
+// caller nudges the dispatcher with Notify and may block on Wait.
+type OutboxDispatcher struct {
+	Store       OutboxStore
+	MaxAttempts int
+	Backoff     time.Duration
+	BatchSize   int
+	Log         *slog.Logger
+
+	mu       sync.Mutex
+	handlers map[string]OutboxHandler
+	waiters  map[string][]chan outboxOutcome
+	wake     chan struct{}
+}
+
+type outboxOutcome struct {
+	msg *domain.OutboxMessage
+	err error
+}
+
+type idempotencyKeyCtxKey struct{}
+
+// WithIdempotencyKey marks outbound calls made with ctx so the upstream can
+// drop duplicates of the same operation.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtxKey{}, key)
+}
+
+func IdempotencyKey(ctx context.Context) (string, bool) {
+	v, ok := ctx.Value(idempotencyKeyCtxKey{}).(string)
+	return v, ok && v != ""
+}
+
+func (d *OutboxDispatcher) Register(operation string, h OutboxHandler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handlers == nil {
+		d.handlers = make(map[string]OutboxHandler)
+	}
+	d.handlers[operation] = h
+}
+
+// Enqueue records an operation. Call it inside the transaction that makes
+// the local change the operation belongs to. Enqueueing the same dedupe key
+// twice yields the original message. The request ID, trace context and
+// deadline of ctx are kept for the deliveries.
+func (d *OutboxDispatcher) Enqueue(ctx context.Context, tenantID domain.TenantID, operation, dedupeKey string, payload any) (*domain.OutboxMessage, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	meta := RequestMetaFrom(ctx)
+	deadline, _ := ctx.Deadline()
+	return d.Store.Enqueue(ctx, &domain.OutboxMessage{
+		ID:            newID(),
+		TenantID:      tenantID,
+		Operation:     operation,
+		DedupeKey:     dedupeKey,
+		Payload:       b,
+		State:         domain.OutboxStatePending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		RequestID:     meta.RequestID,
+		TraceParent:   meta.TraceParent,
+		Deadline:      deadline,
+	})
+}
+
+// Notify asks the dispatcher to look for due messages right away instead of
+// waiting for the next poll.
+func (d *OutboxDispatcher) Notify() {
+	select {
+	case d.wakeChan() <- struct{}{}:
+	default:
+	}
+}
+
+// Wait blocks until the message is delivered or has failed for good. A
+// failed message yields the handler's last error when it failed in this
+// process, and a generic error carrying its text otherwise.
+func (d *OutboxDispatcher) Wait(ctx context.Context, id string) (*domain.OutboxMessage, error) {
+	ch := make(chan outboxOutcome, 1)
+	d.mu.Lock()
+	if d.waiters == nil {
+		d.waiters = make(map[string][]chan outboxOutcome)
+	}
+	d.waiters[id] = append(d.waiters[id], ch)
+	d.mu.Unlock()
+	defer d.removeWaiter(id, ch)
+
+	// The message may have been settled before the waiter was registered.
+	m, err := d.Store.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, NotFound("outbox_message", id)
+	}
+	switch m.State {
+	case domain.OutboxStateDelivered:
+		return m, nil
+	case domain.OutboxStateFailed:
+		return m, &Error{Kind: ErrUpstream, Code: "upstream_error", Entity: "outbox_message", ID: m.ID, Detail: m.LastError}
+	}
+
+	select {
+	case out := <-ch:
+		return out.msg, out.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Run dispatches due messages every interval, or sooner when notified,
+// until ctx is cancelled.
+func (d *OutboxDispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	wake := d.wakeChan()
+	for {
+		if _, err := d.DispatchDue(ctx); err != nil {
+			d.logger().Error("outbox_dispatch", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-wake:
+		}
+	}
+}
+
+// DispatchDue delivers one batch of due messages and returns how many it
+// attempted.
+func (d *OutboxDispatcher) DispatchDue(ctx context.Context) (int, error) {
+	batch := d.BatchSize
+	if batch <= 0 {
+		batch = defaultOutboxBatchSize
+	}
+	msgs, err := d.Store.ClaimDue(ctx, time.Now(), outboxLease, batch)
+	if err != nil {
+		return 0, err
+	}
+	for _, m := range msgs {
+		d.deliver(ctx, m)
+	}
+	return len(msgs), nil
+}
+
+func (d *OutboxDispatcher) deliver(ctx context.Context, m *domain.OutboxMessage) {
+	d.mu.Lock()
+	h := d.handlers[m.Operation]
+	d.mu.Unlock()
+
+	var (
+		result []byte
+		err    error
+	)
+	if h == nil {
+		err = permanent(fmt.Errorf("no_outbox_handler: %s", m.Operation))
+	} else {
+		hctx := WithRequestMeta(WithIdempotencyKey(ctx, m.DedupeKey), RequestMeta{RequestID: m.RequestID, TraceParent: m.TraceParent})
+		if !m.Deadline.IsZero() && time.Now().Before(m.Deadline) {
+			var cancel context.CancelFunc
+			hctx, cancel = context.WithDeadline(hctx, m.Deadline)
+			defer cancel()
+		}
+		result, err = h(hctx, m)
+	}
+
+	attempts := m.Attempts + 1
+	log := d.logger().With("outbox_id", m.ID, "operation", m.Operation, "tenant_id", m.TenantID, "attempt", attempts)
+	if err == nil {
+		if markErr := d.Store.MarkDelivered(ctx, m.ID, result); markErr != nil {
+			// The next claim retries the message; handlers are idempotent
+			// through the dedupe key.
+			log.Error("outbox_mark_delivered", "error", markErr)
+			return
+		}
+		m.State, m.Result, m.Attempts = domain.OutboxStateDelivered, result, attempts
+		d.settle(m, nil)
+		return
+	}
+
+	if retryable(err) && attempts < d.maxAttempts() {
+		next := time.Now().Add(d.backoff(attempts))
+		log.Warn("outbox_retry", "error", err, "next_attempt_at", next)
+		if markErr := d.Store.MarkRetry(ctx, m.ID, err.Error(), next); markErr != nil {
+			log.Error("outbox_mark_retry", "error", markErr)
+		}
+		return
+	}
+
+	log.Error("outbox_failed", "error", err)
+	if markErr := d.Store.MarkFailed(ctx, m.ID, err.Error()); markErr != nil {
+		log.Error("outbox_mark_failed", "error", markErr)
+		return
+	}
+	m.State, m.LastError, m.Attempts = domain.OutboxStateFailed, err.Error(), attempts
+	d.settle(m, err)
+}
+
+func (d *OutboxDispatcher) settle(m *domain.OutboxMessage, err error) {
+	d.mu.Lock()
+	chans := d.waiters[m.ID]
+	delete(d.waiters, m.ID)
+	d.mu.Unlock()
+	for _, ch := range chans {
+		ch <- outboxOutcome{msg: m, err: err}
+	}
+}
+
+func (d *OutboxDispatcher) removeWaiter(id string, ch chan outboxOutcome) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	chans := d.waiters[id]
+	for i, c := range chans {
+		if c == ch {
+			d.waiters[id] = append(chans[:i], chans[i+1:]...)
+			break
+		}
+	}
+	if len(d.waiters[id]) == 0 {
+		delete(d.waiters, id)
+	}
+}
+
+func (d *OutboxDispatcher) wakeChan() chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.wake == nil {
+		d.wake = make(chan struct{}, 1)
+	}
+	return d.wake
+}
+
+func (d *OutboxDispatcher) backoff(attempts int) time.Duration {
+	base := d.Backoff
+	if base <= 0 {
+		base = defaultOutboxBackoff
+	}
+	wait := base << (attempts - 1)
+	if wait <= 0 || wait > maxOutboxBackoff {
+		return maxOutboxBackoff
+	}
+	return wait
+}
+
+func (d *OutboxDispatcher) maxAttempts() int {
+	if d.MaxAttempts > 0 {
+		return d.MaxAttempts
+	}
+	return defaultOutboxMaxAttempts
+}
+
+func (d *OutboxDispatcher) logger() *slog.Logger {
+	if d.Log != nil {
+		return d.Log
+	}
+	return slog.Default()
+}
+
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string   { return e.err.Error() }
+func (e *permanentError) Unwrap() error   { return e.err }
+func (e *permanentError) Temporary() bool { return false }
+
+func permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// retryable reports whether err is worth another attempt. Errors are retried
+// unless something in the chain says it is not temporary.
+func retryable(err error) bool {
+	var t interface{ Temporary() bool }
+	if errors.As(err, &t) {
+		return t.Temporary()
+	}
+	return true
+}
@@ -0,0 +1,52 @@
+package application
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"trustpin_integration/internal/domain"
+)
+
+const defaultPairingLinkBase = "trustpin://pair"
+
+// PairingLink returns the deep link that pairs the Trustpin app with the
+// device enrolled as enrollmentID, and when the pairing expires. Only the
+// user who enrolled the device may read it, and only until the pairing is
+// completed or expires.
+func (s *MFAService) PairingLink(ctx context.Context, tenantID domain.TenantID, userID, enrollmentID string) (string, time.Time, error) {
+	d, err := s.Devices.GetByTrustPinEnrollID(ctx, tenantID, enrollmentID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	// Another user's enrollment is reported as missing so its existence
+	// does not leak.
+	if d == nil || d.UserID != userID {
+		return "", time.Time{}, NotFound("enrollment", enrollmentID)
+	}
+	if d.State != domain.DeviceStatePairingPending || d.PairingCode == "" {
+		return "", time.Time{}, InvalidState("device", d.ID, d.State)
+	}
+	if !d.PairingExpiresAt.After(time.Now()) {
+		return "", time.Time{}, Expired("enrollment", enrollmentID)
+	}
+	code, err := s.Secrets.Open(d.PairingCode)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	base := s.PairingLinkBase
+	if base == "" {
+		base = defaultPairingLinkBase
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	q := u.Query()
+	q.Set("code", string(code))
+	q.Set("tenant", string(tenantID))
+	q.Set("expires", d.PairingExpiresAt.UTC().Format(time.RFC3339))
+	u.RawQuery = q.Encode()
+	return u.String(), d.PairingExpiresAt, nil
+}
@@ -0,0 +1,245 @@
+package application
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"time"
+
+	"trustpin_integration/internal/domain"
+)
+
+// Built-in policy values, used where neither the tenant's policy nor the
+// service defaults set one.
+const (
+	defaultChallengeTTL   = 2 * time.Minute
+	defaultNonceTTL       = 5 * time.Minute
+	defaultTokenTTL       = 15 * time.Minute
+	defaultIdempotencyTTL = 5 * time.Minute
+)
+
+// knownFactors are the device types a policy may allow.
+var knownFactors = []string{domain.DeviceTypeTrustPin, domain.DeviceTypeTOTP}
+
+// knownActions are the actions a policy may require MFA for. Other
+// challenges are asked for by the caller, so the policy has no say in them.
+var knownActions = []string{loginAction}
+
+// PolicyService resolves the MFA policy that applies to a tenant and lets
+// tenant admins change it.
+type PolicyService struct {
+	Policies TenantPolicyRepository
+	Users    UserRepository
+	Audit    AuditRepository
+	// Defaults applies to every tenant for the fields its own policy leaves
+	// zero.
+	Defaults domain.TenantPolicy
+	Log      *slog.Logger
+	// Providers, when set, checks that policies name registered providers.
+	Providers *ProviderRegistry
+}
+
+// Effective returns the policy in force for tenantID: its stored policy over
+// the service defaults over the built-in values. A nil service yields the
+// built-in values, so callers need not check whether policies are wired.
+func (p *PolicyService) Effective(ctx context.Context, tenantID domain.TenantID) (*domain.TenantPolicy, error) {
+	eff := domain.TenantPolicy{
+		ChallengeTTL:   defaultChallengeTTL,
+		NonceTTL:       defaultNonceTTL,
+		TokenTTL:       defaultTokenTTL,
+		IdempotencyTTL: defaultIdempotencyTTL,
+	}
+	if p == nil {
+		eff.TenantID = tenantID
+		return &eff, nil
+	}
+	eff = overlayPolicy(eff, p.Defaults)
+	if p.Policies != nil {
+		stored, err := p.Policies.Get(ctx, tenantID)
+		if err != nil {
+			return nil, err
+		}
+		if stored != nil {
+			eff = overlayPolicy(eff, *stored)
+			eff.UpdatedAt = stored.UpdatedAt
+		}
+	}
+	if len(eff.Providers) == 0 && p.Providers != nil {
+		eff.Providers = p.Providers.Names()
+	}
+	eff.TenantID = tenantID
+	return &eff, nil
+}
+
+// Get returns the tenant's stored policy, empty when it has none, and the
+// policy in force. The caller must be an admin or auditor of the tenant.
+func (p *PolicyService) Get(ctx context.Context, tenantID domain.TenantID, callerID string) (stored, effective *domain.TenantPolicy, err error) {
+	if err := requireRole(ctx, p.Users, tenantID, callerID, domain.RoleAdmin, domain.RoleAuditor); err != nil {
+		return nil, nil, err
+	}
+	if stored, err = p.Policies.Get(ctx, tenantID); err != nil {
+		return nil, nil, err
+	}
+	if stored == nil {
+		stored = &domain.TenantPolicy{TenantID: tenantID}
+	}
+	if effective, err = p.Effective(ctx, tenantID); err != nil {
+		return nil, nil, err
+	}
+	return stored, effective, nil
+}
+
+// Put replaces the tenant's policy with pol and returns the policy now in
+// force. Zero fields fall back to the defaults. The caller must be an admin
+// of the tenant.
+func (p *PolicyService) Put(ctx context.Context, tenantID domain.TenantID, callerID string, pol *domain.TenantPolicy) (_ *domain.TenantPolicy, err error) {
+	defer func() {
+		auditResult(ctx, p.Audit, p.logger(), tenantID, callerID, auditPolicyUpdate, err, policyAuditPayload(pol))
+	}()
+	if err := requireRole(ctx, p.Users, tenantID, callerID, domain.RoleAdmin); err != nil {
+		return nil, err
+	}
+	if err := p.validate(pol); err != nil {
+		return nil, err
+	}
+	pol.TenantID = tenantID
+	pol.UpdatedAt = time.Now().UTC()
+	if err := p.Policies.Save(ctx, pol); err != nil {
+		return nil, err
+	}
+	return p.Effective(ctx, tenantID)
+}
+
+func (p *PolicyService) validate(pol *domain.TenantPolicy) error {
+	if pol.MaxDevicesPerUser < 0 || pol.MaxConsecutiveDenials < 0 ||
+		slices.ContainsFunc([]time.Duration{pol.ChallengeTTL, pol.NonceTTL, pol.TokenTTL, pol.IdempotencyTTL, pol.LockoutBase, pol.LockoutMax}, func(d time.Duration) bool { return d < 0 }) {
+		return InvalidInput("invalid_policy")
+	}
+	for _, a := range pol.MFAActions {
+		if !slices.Contains(knownActions, a) {
+			return InvalidInput("unknown_action")
+		}
+	}
+	for _, f := range pol.AllowedFactors {
+		if !slices.Contains(knownFactors, f) {
+			return InvalidInput("unknown_factor")
+		}
+	}
+	if p.Providers != nil {
+		for _, name := range pol.Providers {
+			if _, ok := p.Providers.Get(name); !ok {
+				return InvalidInput("unknown_provider")
+			}
+		}
+	}
+	if pol.LockoutBase > 0 && pol.LockoutMax > 0 && pol.LockoutBase > pol.LockoutMax {
+		return InvalidInput("invalid_lockout")
+	}
+	// A nonce must outlive the challenge it approves, or a captured approval
+	// could be replayed while the challenge is still open.
+	eff := overlayPolicy(overlayPolicy(domain.TenantPolicy{ChallengeTTL: defaultChallengeTTL, NonceTTL: defaultNonceTTL}, p.Defaults), *pol)
+	if eff.NonceTTL < eff.ChallengeTTL {
+		return InvalidInput("nonce_ttl_too_short")
+	}
+	return nil
+}
+
+func (p *PolicyService) logger() *slog.Logger {
+	if p.Log != nil {
+		return p.Log
+	}
+	return slog.Default()
+}
+
+// overlayPolicy returns base with every non-zero field of over applied.
+func overlayPolicy(base, over domain.TenantPolicy) domain.TenantPolicy {
+	if over.MFAActions != nil {
+		base.MFAActions = over.MFAActions
+	}
+	if over.AllowedFactors != nil {
+		base.AllowedFactors = over.AllowedFactors
+	}
+	if over.MaxDevicesPerUser != 0 {
+		base.MaxDevicesPerUser = over.MaxDevicesPerUser
+	}
+	if over.ChallengeTTL != 0 {
+		base.ChallengeTTL = over.ChallengeTTL
+	}
+	if over.NonceTTL != 0 {
+		base.NonceTTL = over.NonceTTL
+	}
+	if over.TokenTTL != 0 {
+		base.TokenTTL = over.TokenTTL
+	}
+	if over.IdempotencyTTL != 0 {
+		base.IdempotencyTTL = over.IdempotencyTTL
+	}
+	if over.MaxConsecutiveDenials != 0 {
+		base.MaxConsecutiveDenials = over.MaxConsecutiveDenials
+	}
+	if over.LockoutBase != 0 {
+		base.LockoutBase = over.LockoutBase
+	}
+	if over.LockoutMax != 0 {
+		base.LockoutMax = over.LockoutMax
+	}
+	if over.Providers != nil {
+		base.Providers = over.Providers
+	}
+	return base
+}
+
+func policyAuditPayload(pol *domain.TenantPolicy) map[string]any {
+	if pol == nil {
+		return nil
+	}
+	return map[string]any{
+		"mfa_actions":             pol.MFAActions,
+		"allowed_factors":         pol.AllowedFactors,
+		"max_devices_per_user":    pol.MaxDevicesPerUser,
+		"challenge_ttl":           pol.ChallengeTTL.String(),
+		"nonce_ttl":               pol.NonceTTL.String(),
+		"token_ttl":               pol.TokenTTL.String(),
+		"idempotency_ttl":         pol.IdempotencyTTL.String(),
+		"max_consecutive_denials": pol.MaxConsecutiveDenials,
+		"lockout_base":            pol.LockoutBase.String(),
+		"lockout_max":             pol.LockoutMax.String(),
+		"providers":               pol.Providers,
+	}
+}
+
+// policy returns the policy in force for tenantID.
+func (s *MFAService) policy(ctx context.Context, tenantID domain.TenantID) (*domain.TenantPolicy, error) {
+	return s.Policies.Effective(ctx, tenantID)
+}
+
+// checkEnrollPolicy refuses enrolling a deviceType device for the user when
+// the tenant does not allow the factor or the user already has as many
+// devices as the tenant permits. A revoked device, or the stale record being
+// enrolled again under deviceID, does not count.
+func (s *MFAService) checkEnrollPolicy(ctx context.Context, tenantID domain.TenantID, userID, deviceID, deviceType string) error {
+	pol, err := s.policy(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	if !pol.AllowsFactor(deviceType) {
+		return Forbidden("factor_not_allowed")
+	}
+	if pol.MaxDevicesPerUser <= 0 {
+		return nil
+	}
+	devices, _, err := s.Devices.ListByUser(ctx, tenantID, userID, 0, loginDeviceScan)
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, d := range devices {
+		if d.State != domain.DeviceStateRevoked && d.ID != deviceID {
+			n++
+		}
+	}
+	if n >= pol.MaxDevicesPerUser {
+		return Conflict("device_limit_reached", "device", deviceID)
+	}
+	return nil
+}
@@ -20,13 +20,128 @@ type SessionRepository interface {
 type DeviceRepository interface {
 	Create(ctx context.Context, d *domain.MFADevice) error
 	GetByID(ctx context.Context, tenantID domain.TenantID, id string) (*domain.MFADevice, error)
+	GetByTrustPinDeviceID(ctx context.Context, tenantID domain.TenantID, trustPinDeviceID string) (*domain.MFADevice, error)
+	GetByTrustPinEnrollID(ctx context.Context, tenantID domain.TenantID, enrollID string) (*domain.MFADevice, error)
+	// Update persists the mutable attributes of d (name, public key, state,
+	// Trustpin identifiers and pairing code).
+	Update(ctx context.Context, d *domain.MFADevice) error
 	UpdateState(ctx context.Context, tenantID domain.TenantID, id, state string) error
+	UpdateName(ctx context.Context, tenantID domain.TenantID, id, name string) error
+	// SetPrimary makes deviceID the user's only primary device; an empty
+	// deviceID leaves the user without one.
+	SetPrimary(ctx context.Context, tenantID domain.TenantID, userID, deviceID string) error
+	// ListByUser returns one page of the user's devices ordered by creation
+	// time, along with the total number of devices the user has.
+	ListByUser(ctx context.Context, tenantID domain.TenantID, userID string, offset, limit int) ([]*domain.MFADevice, int, error)
+	Delete(ctx context.Context, tenantID domain.TenantID, id string) error
+	// ListExpiredPairings returns PENDING and PAIRING_PENDING devices of all
+	// tenants whose pairing window ended before the given time.
+	ListExpiredPairings(ctx context.Context, before time.Time) ([]*domain.MFADevice, error)
 }
 
 type ChallengeRepository interface {
 	Create(ctx context.Context, c *domain.MFAChallenge) error
 	GetByID(ctx context.Context, tenantID domain.TenantID, id string) (*domain.MFAChallenge, error)
 	UpdateState(ctx context.Context, tenantID domain.TenantID, id, state string) error
+	ListByDevice(ctx context.Context, tenantID domain.TenantID, deviceID string) ([]*domain.MFAChallenge, error)
+	// ListByParent returns the per-device challenges of a fan-out.
+	ListByParent(ctx context.Context, tenantID domain.TenantID, parentID string) ([]*domain.MFAChallenge, error)
+	// Close moves an open challenge to state. It reports false when the
+	// challenge was no longer open, so only the first answer settles it.
+	Close(ctx context.Context, tenantID domain.TenantID, id, state string) (bool, error)
+	// ListOpenByUser returns the user's challenges that still wait for an
+	// answer and have not expired at now.
+	ListOpenByUser(ctx context.Context, tenantID domain.TenantID, userID string, now time.Time) ([]*domain.MFAChallenge, error)
+	// ExpireOpen moves the open challenges of all tenants whose answer window
+	// ended before now to EXPIRED and returns them.
+	ExpireOpen(ctx context.Context, now time.Time) ([]*domain.MFAChallenge, error)
+}
+
+// ChallengeHistoryRepository keeps the transitions of each challenge.
+type ChallengeHistoryRepository interface {
+	Append(ctx context.Context, t *domain.ChallengeTransition) error
+	// List returns the challenge's transitions in the order they were
+	// appended.
+	List(ctx context.Context, tenantID domain.TenantID, challengeID string) ([]*domain.ChallengeTransition, error)
+}
+
+type MFATransactionRepository interface {
+	Create(ctx context.Context, t *domain.MFATransaction) error
+	GetByID(ctx context.Context, tenantID domain.TenantID, id string) (*domain.MFATransaction, error)
+	// Complete moves a PENDING transaction to COMPLETED. It reports false
+	// when the transaction was not PENDING, so each one is used only once.
+	Complete(ctx context.Context, tenantID domain.TenantID, id string) (bool, error)
+}
+
+type RecoveryCodeRepository interface {
+	// ReplaceForUser deletes the user's existing codes, used or not, and
+	// stores codes in their place.
+	ReplaceForUser(ctx context.Context, tenantID domain.TenantID, userID string, codes []*domain.RecoveryCode) error
+	// Consume marks the user's unused code with the given hash as used at
+	// usedAt. It reports false when there is no such unused code.
+	Consume(ctx context.Context, tenantID domain.TenantID, userID, codeHash string, usedAt time.Time) (bool, error)
+}
+
+type AuditRepository interface {
+	// Append chains entry to the tenant's head with ChainAuditEntry and
+	// stores it. Appends for one tenant are serialized.
+	Append(ctx context.Context, entry *domain.AuditLog) error
+	// Chain returns all of the tenant's entries in Seq order.
+	Chain(ctx context.Context, tenantID domain.TenantID) ([]*domain.AuditLog, error)
+	// Heads returns the last entry of every tenant that has one.
+	Heads(ctx context.Context) ([]*domain.AuditLog, error)
+	SaveCheckpoint(ctx context.Context, cp *domain.AuditCheckpoint) error
+	// Checkpoints returns the tenant's checkpoints, oldest first.
+	Checkpoints(ctx context.Context, tenantID domain.TenantID) ([]*domain.AuditCheckpoint, error)
+	// List returns one page of the tenant's entries matching f, newest
+	// first, along with the number of matching entries.
+	List(ctx context.Context, tenantID domain.TenantID, f AuditFilter, offset, limit int) ([]*domain.AuditLog, int, error)
+}
+
+// TenantPolicyRepository stores one policy per tenant.
+type TenantPolicyRepository interface {
+	// Get returns nil for a tenant without a stored policy.
+	Get(ctx context.Context, tenantID domain.TenantID) (*domain.TenantPolicy, error)
+	Save(ctx context.Context, p *domain.TenantPolicy) error
+}
+
+// AuditSigner signs audit chain heads, e.g. with the service's JWT key.
+type AuditSigner interface {
+	SignAuditCheckpoint(cp *domain.AuditCheckpoint) (string, error)
+}
+
+// AuditCheckpointVerifier checks that cp.Signature was made by the service
+// for exactly cp's tenant, Seq and Hash.
+type AuditCheckpointVerifier interface {
+	VerifyAuditCheckpoint(cp *domain.AuditCheckpoint) error
+}
+
+// AuditFilter narrows an audit query; zero fields match everything. The time
+// range includes From and excludes To.
+type AuditFilter struct {
+	UserID    string
+	EventType string
+	From      time.Time
+	To        time.Time
+}
+
+// TxManager runs fn in one storage transaction. Repositories called with the
+// context handed to fn take part in that transaction.
+type TxManager interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type OutboxStore interface {
+	// Enqueue stores m unless a message with the same tenant and dedupe key
+	// already exists, in which case the existing message is returned.
+	Enqueue(ctx context.Context, m *domain.OutboxMessage) (*domain.OutboxMessage, error)
+	GetByID(ctx context.Context, id string) (*domain.OutboxMessage, error)
+	// ClaimDue returns up to limit PENDING messages due at now and pushes
+	// their next attempt out by lease so no other dispatcher picks them up.
+	ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*domain.OutboxMessage, error)
+	MarkDelivered(ctx context.Context, id string, result []byte) error
+	MarkRetry(ctx context.Context, id, lastErr string, next time.Time) error
+	MarkFailed(ctx context.Context, id, lastErr string) error
 }
 
 type NonceStore interface {
@@ -38,18 +153,51 @@ type IdempotencyStore interface {
 	Set(ctx context.Context, tenantID domain.TenantID, key string, value []byte, ttl time.Duration) error
 }
 
-type TrustPinAdapter interface {
-	Enroll(ctx context.Context, req TrustPinEnrollRequest) (*TrustPinEnrollResponse, error)
-	Activate(ctx context.Context, req TrustPinActivateRequest) (*TrustPinActivateResponse, error)
+// CounterStore keeps short-lived counters for rate limiting. Missing and
+// expired keys read as zero.
+type CounterStore interface {
+	// Incr adds one to key and returns the new value. A key that did not
+	// exist starts at one and expires after ttl.
+	Incr(ctx context.Context, tenantID domain.TenantID, key string, ttl time.Duration) (int64, error)
+	Get(ctx context.Context, tenantID domain.TenantID, key string) (int64, error)
+	Set(ctx context.Context, tenantID domain.TenantID, key string, value int64, ttl time.Duration) error
+	Delete(ctx context.Context, tenantID domain.TenantID, key string) error
+}
+
+// SecretCipher seals secrets for storage and opens them again.
+type SecretCipher interface {
+	Seal(plaintext []byte) (string, error)
+	Open(sealed string) ([]byte, error)
+}
+
+// FactorProvider delivers the second factor for one device type: it sends
+// challenges to the type's devices, checks or forwards their answers and
+// revokes them.
+type FactorProvider interface {
+	// Name identifies the provider in tenant policies, on devices and in
+	// queued operations.
+	Name() string
+	// DeviceType is the type of the devices the provider serves.
+	DeviceType() string
 	CreateChallenge(ctx context.Context, req TrustPinChallengeRequest) (*TrustPinChallengeResponse, error)
 	Approve(ctx context.Context, req TrustPinApproveRequest) (*TrustPinApproveResponse, error)
+	RevokeDevice(ctx context.Context, req TrustPinRevokeRequest) error
 }
 
-// Request/response DTOs abstracted from adapter.
+// PairingProvider is a FactorProvider whose devices pair through it, as
+// Trustpin devices do.
+type PairingProvider interface {
+	FactorProvider
+	Enroll(ctx context.Context, req TrustPinEnrollRequest) (*TrustPinEnrollResponse, error)
+	Activate(ctx context.Context, req TrustPinActivateRequest) (*TrustPinActivateResponse, error)
+	CancelEnrollment(ctx context.Context, req TrustPinCancelEnrollmentRequest) error
+}
+
+// Request/response DTOs abstracted from the providers.
 type TrustPinEnrollRequest struct {
-	TenantID   string
-	UserID     string
-	DeviceID   string
+	TenantID string
+	UserID   string
+	DeviceID string
 }
 
 type TrustPinEnrollResponse struct {
@@ -73,11 +221,11 @@ type TrustPinActivateResponse struct {
 }
 
 type TrustPinChallengeRequest struct {
-	TenantID   string
-	UserID     string
-	DeviceID   string
-	Action     string
-	Context    map[string]any
+	TenantID string
+	UserID   string
+	DeviceID string
+	Action   string
+	Context  map[string]any
 }
 
 type TrustPinChallengeResponse struct {
@@ -85,6 +233,19 @@ type TrustPinChallengeResponse struct {
 	State       string `json:"state"`
 	IssuedAt    string `json:"issued_at"`
 	ExpiresAt   string `json:"expires_at"`
+	// NumberMatch is filled in by the service, not Trustpin, for the web
+	// client to display.
+	NumberMatch string `json:"number_match,omitempty"`
+	// Devices lists the devices a fan-out challenge was sent to.
+	Devices []string `json:"devices,omitempty"`
+	// TransactionHash and TransactionText are filled in by the service for
+	// transaction-signing challenges.
+	TransactionHash string `json:"transaction_hash,omitempty"`
+	TransactionText string `json:"transaction_text,omitempty"`
+	// Approvers and Quorum describe a quorum challenge: the approvers it
+	// reached and how many of them must approve.
+	Approvers []string `json:"approvers,omitempty"`
+	Quorum    int      `json:"quorum,omitempty"`
 }
 
 type TrustPinApproveRequest struct {
@@ -95,9 +256,24 @@ type TrustPinApproveRequest struct {
 	Signature   string
 	Payload     map[string]any
 	TOTPCode    string
+	// Provider names the provider the approval goes to when it is queued.
+	Provider string
 }
 
 type TrustPinApproveResponse struct {
 	ChallengeID string `json:"challenge_id"`
 	Status      string `json:"status"`
 }
+
+type TrustPinRevokeRequest struct {
+	TenantID string
+	UserID   string
+	DeviceID string
+	Provider string
+}
+
+type TrustPinCancelEnrollmentRequest struct {
+	TenantID     string
+	EnrollmentID string
+	Provider     string
+}
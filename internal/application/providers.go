@@ -0,0 +1,233 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+
+	"trustpin_integration/internal/domain"
+)
+
+// legacyProvider serves devices and queued operations recorded before
+// providers were named, all of which went to Trustpin.
+const legacyProvider = "trustpin"
+
+// ProviderRegistry holds the factor providers the service can route to.
+type ProviderRegistry struct {
+	mu        sync.RWMutex
+	providers map[string]FactorProvider
+	order     []string
+}
+
+func NewProviderRegistry(providers ...FactorProvider) *ProviderRegistry {
+	r := &ProviderRegistry{providers: make(map[string]FactorProvider)}
+	for _, p := range providers {
+		r.Register(p)
+	}
+	return r
+}
+
+// Register adds p, replacing a provider registered under the same name.
+func (r *ProviderRegistry) Register(p FactorProvider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.providers[p.Name()]; !ok {
+		r.order = append(r.order, p.Name())
+	}
+	r.providers[p.Name()] = p
+}
+
+// Get returns the provider registered as name.
+func (r *ProviderRegistry) Get(name string) (FactorProvider, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.providers[name]
+	return p, ok
+}
+
+// Names returns the registered provider names in registration order.
+func (r *ProviderRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.order)
+}
+
+// chain returns the registered providers named in names, in that order;
+// empty names yields every provider in registration order.
+func (r *ProviderRegistry) chain(names []string) []FactorProvider {
+	if len(names) == 0 {
+		names = r.Names()
+	}
+	out := make([]FactorProvider, 0, len(names))
+	for _, n := range names {
+		if p, ok := r.Get(n); ok {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// providerChain returns the tenant's providers in order of preference.
+func (s *MFAService) providerChain(ctx context.Context, tenantID domain.TenantID) ([]FactorProvider, error) {
+	pol, err := s.policy(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return s.Providers.chain(pol.Providers), nil
+}
+
+// typeProvider returns the tenant's provider for devices of deviceType.
+func (s *MFAService) typeProvider(ctx context.Context, tenantID domain.TenantID, deviceType string) (FactorProvider, error) {
+	chain, err := s.providerChain(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range chain {
+		if p.DeviceType() == deviceType {
+			return p, nil
+		}
+	}
+	return nil, Forbidden("factor_not_allowed")
+}
+
+// deviceProvider returns the provider serving d: the one it was enrolled
+// with, or the tenant's provider for its type when it records none.
+func (s *MFAService) deviceProvider(ctx context.Context, d *domain.MFADevice) (FactorProvider, error) {
+	if d.Provider == "" {
+		return s.typeProvider(ctx, d.TenantID, deviceType(d))
+	}
+	return s.namedProvider(d.Provider)
+}
+
+// namedProvider returns the provider a device or queued operation names.
+func (s *MFAService) namedProvider(name string) (FactorProvider, error) {
+	if name == "" {
+		name = legacyProvider
+	}
+	p, ok := s.Providers.Get(name)
+	if !ok {
+		return nil, InvalidState("provider", name, "")
+	}
+	return p, nil
+}
+
+// pairingProvider returns the tenant's provider pairing devices of
+// deviceType.
+func (s *MFAService) pairingProvider(ctx context.Context, tenantID domain.TenantID, deviceType string) (PairingProvider, error) {
+	p, err := s.typeProvider(ctx, tenantID, deviceType)
+	if err != nil {
+		return nil, err
+	}
+	pp, ok := p.(PairingProvider)
+	if !ok {
+		return nil, Forbidden("factor_not_allowed")
+	}
+	return pp, nil
+}
+
+// providerUnavailable reports whether err means the provider could not be
+// reached for now, so another one may stand in.
+func providerUnavailable(err error) bool {
+	var up *UpstreamError
+	return errors.As(err, &up) && up.Temporary()
+}
+
+// failover delivers c through the first of the tenant's providers after the
+// unavailable provider for failedType that serves another device type and
+// reaches one of the user's active devices, e.g. their TOTP app while
+// Trustpin is down. cause is returned when there is none.
+func (s *MFAService) failover(ctx context.Context, c *domain.MFAChallenge, failedType string, req TrustPinChallengeRequest, number string, cause error) (*TrustPinChallengeResponse, string, error) {
+	pol, err := s.policy(ctx, c.TenantID)
+	if err != nil {
+		return nil, "", err
+	}
+	chain := s.Providers.chain(pol.Providers)
+	start := slices.IndexFunc(chain, func(p FactorProvider) bool { return p.DeviceType() == failedType })
+	if start < 0 {
+		return nil, "", cause
+	}
+	devices, _, err := s.Devices.ListByUser(ctx, c.TenantID, c.UserID, 0, loginDeviceScan)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, p := range chain[start+1:] {
+		if p.DeviceType() == failedType || !pol.AllowsFactor(p.DeviceType()) {
+			continue
+		}
+		if c.TransactionHash != "" && p.DeviceType() == domain.DeviceTypeTOTP {
+			continue
+		}
+		i := slices.IndexFunc(devices, func(d *domain.MFADevice) bool {
+			return d.State == domain.DeviceStateActive && deviceType(d) == p.DeviceType()
+		})
+		if i < 0 {
+			continue
+		}
+		d := devices[i]
+		if err := s.checkChallengeLimits(ctx, []*domain.MFADevice{d}); err != nil {
+			return nil, "", err
+		}
+		s.logger().Warn("provider_failover", "tenant_id", c.TenantID, "user_id", c.UserID, "device_type", failedType, "provider", p.Name(), "device_id", d.ID, "error", cause)
+		if isTOTP(d) {
+			number = ""
+		}
+		c.DeviceID = d.ID
+		res, err := s.createSingle(ctx, c, d, req, number)
+		return res, p.Name(), err
+	}
+	return nil, "", cause
+}
+
+// deviceType returns the type of d; devices from before types were recorded
+// are Trustpin devices.
+func deviceType(d *domain.MFADevice) string {
+	if d.Type == "" {
+		return domain.DeviceTypeTrustPin
+	}
+	return d.Type
+}
+
+// TOTPProviderName names the built-in TOTP provider.
+const TOTPProviderName = "totp"
+
+// TOTPProvider returns the built-in provider for TOTP devices. Their
+// challenges wait for a code, which is checked against the device secret
+// without leaving the service.
+func (s *MFAService) TOTPProvider() FactorProvider {
+	return totpProvider{s}
+}
+
+type totpProvider struct {
+	s *MFAService
+}
+
+func (totpProvider) Name() string { return TOTPProviderName }
+
+func (totpProvider) DeviceType() string { return domain.DeviceTypeTOTP }
+
+func (totpProvider) CreateChallenge(ctx context.Context, req TrustPinChallengeRequest) (*TrustPinChallengeResponse, error) {
+	return &TrustPinChallengeResponse{State: domain.ChallengeStateCodeRequired}, nil
+}
+
+func (p totpProvider) Approve(ctx context.Context, req TrustPinApproveRequest) (*TrustPinApproveResponse, error) {
+	if req.TOTPCode == "" {
+		return nil, InvalidInput("missing_totp_code")
+	}
+	d, err := p.s.Devices.GetByID(ctx, domain.TenantID(req.TenantID), req.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil || d.State != domain.DeviceStateActive {
+		return nil, InvalidState("device", req.DeviceID, "")
+	}
+	if err := p.s.checkTOTP(ctx, d, req.TOTPCode); err != nil {
+		return nil, err
+	}
+	return &TrustPinApproveResponse{ChallengeID: req.ChallengeID, Status: domain.ChallengeStateApproved}, nil
+}
+
+// RevokeDevice has nothing to do: the secret goes with the local record.
+func (totpProvider) RevokeDevice(ctx context.Context, req TrustPinRevokeRequest) error {
+	return nil
+}
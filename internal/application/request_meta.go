@@ -0,0 +1,30 @@
+package application
+
+import "context"
+
+// RequestMeta describes the request an operation runs for. It is copied into
+// audit entries and feeds the risk rules.
+type RequestMeta struct {
+	RequestID string
+	IP        string
+	UserAgent string
+	// Country is the client's ISO 3166 country code as resolved by a proxy
+	// in front of the service, empty when unknown.
+	Country string
+	// TraceParent is the W3C traceparent of the request, continued on the
+	// calls made for it; empty for work not started by a request.
+	TraceParent string
+}
+
+type requestMetaKey struct{}
+
+func WithRequestMeta(ctx context.Context, m RequestMeta) context.Context {
+	return context.WithValue(ctx, requestMetaKey{}, m)
+}
+
+// RequestMetaFrom returns the metadata stored in ctx, or the zero value for
+// work not started by a request.
+func RequestMetaFrom(ctx context.Context) RequestMeta {
+	m, _ := ctx.Value(requestMetaKey{}).(RequestMeta)
+	return m
+}
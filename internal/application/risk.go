@@ -0,0 +1,124 @@
+package application
+
+import (
+	"context"
+	"time"
+
+	"trustpin_integration/internal/domain"
+)
+
+// RiskSignals is what the risk rules know about a challenge request.
+type RiskSignals struct {
+	TenantID  domain.TenantID
+	UserID    string
+	Action    string
+	IP        string
+	UserAgent string
+	// Country is the ISO 3166 code of the client, empty when unknown.
+	Country string
+	Time    time.Time
+	// DeviceAge is how long ago the challenged device was enrolled.
+	DeviceAge time.Duration
+	// RecentFailures counts the user's denials since their last approval.
+	RecentFailures int
+	// Context is the caller's challenge context, as forwarded to Trustpin.
+	Context map[string]any
+}
+
+// RiskRule scores one aspect of a challenge request. A rule that does not
+// apply returns 0; negative scores mark signals that lower the risk, such as
+// a trusted network.
+type RiskRule interface {
+	Name() string
+	Score(ctx context.Context, sig RiskSignals) int
+}
+
+// RiskEngine sums the scores of its rules and maps the total to a decision.
+// A score below AllowBelow needs no MFA; at or above NumberMatchAt the push
+// uses number matching and at or above DenyAt the challenge is refused. A
+// zero threshold disables its step, AllowBelow included: rules with negative
+// scores, such as a trusted network, never waive MFA on their own. An engine
+// without rules or thresholds sends a plain push as before.
+type RiskEngine struct {
+	Rules         []RiskRule
+	AllowBelow    int
+	NumberMatchAt int
+	DenyAt        int
+}
+
+// RiskAssessment is the outcome of evaluating a challenge request.
+type RiskAssessment struct {
+	Score    int
+	Rules    []string
+	Decision string
+}
+
+func (e *RiskEngine) Evaluate(ctx context.Context, sig RiskSignals) RiskAssessment {
+	var a RiskAssessment
+	for _, r := range e.Rules {
+		if n := r.Score(ctx, sig); n != 0 {
+			a.Score += n
+			a.Rules = append(a.Rules, r.Name())
+		}
+	}
+	switch {
+	case e.DenyAt > 0 && a.Score >= e.DenyAt:
+		a.Decision = domain.RiskDecisionDeny
+	case e.NumberMatchAt > 0 && a.Score >= e.NumberMatchAt:
+		a.Decision = domain.RiskDecisionPushNumberMatch
+	case e.AllowBelow != 0 && a.Score < e.AllowBelow:
+		a.Decision = domain.RiskDecisionAllow
+	default:
+		a.Decision = domain.RiskDecisionPush
+	}
+	return a
+}
+
+// assessRisk evaluates a challenge request for d. Without a risk engine
+// every challenge is a plain push.
+func (s *MFAService) assessRisk(ctx context.Context, d *domain.MFADevice, req TrustPinChallengeRequest) (RiskAssessment, error) {
+	if s.Risk == nil {
+		return RiskAssessment{Decision: domain.RiskDecisionPush}, nil
+	}
+	now := time.Now()
+	meta := RequestMetaFrom(ctx)
+	sig := RiskSignals{
+		TenantID:  d.TenantID,
+		UserID:    d.UserID,
+		Action:    req.Action,
+		IP:        meta.IP,
+		UserAgent: meta.UserAgent,
+		Country:   meta.Country,
+		Time:      now,
+		DeviceAge: now.Sub(d.CreatedAt),
+		Context:   req.Context,
+	}
+	if s.Counters != nil {
+		n, err := s.Counters.Get(ctx, d.TenantID, denialsKey(d.UserID))
+		if err != nil {
+			return RiskAssessment{}, err
+		}
+		sig.RecentFailures = int(n)
+	}
+	return s.Risk.Evaluate(ctx, sig), nil
+}
+
+// settleByRisk records a challenge the risk decision closes on creation:
+// approved without reaching the device, or denied. A denied challenge is
+// stored before the error is returned so it shows in the user's history; it
+// does not count towards a lockout, as the user never refused it.
+func (s *MFAService) settleByRisk(ctx context.Context, c *domain.MFAChallenge) (*TrustPinChallengeResponse, error) {
+	c.State = domain.ChallengeStateApproved
+	if c.RiskDecision == domain.RiskDecisionDeny {
+		c.State = domain.ChallengeStateDenied
+	}
+	if err := s.Challenges.Create(ctx, c); err != nil {
+		return nil, err
+	}
+	ctx = withActor(ctx, domain.ChallengeActorRiskEngine, RequestMetaFrom(ctx).RequestID)
+	s.challengeChanged(ctx, c.TenantID, c.UserID, c.ID, c.State)
+	if c.State == domain.ChallengeStateDenied {
+		return nil, Forbidden("risk_denied")
+	}
+	return challengeResponse(c), nil
+}
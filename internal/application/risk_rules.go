@@ -0,0 +1,130 @@
+package application
+
+import (
+	"context"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+)
+
+// NetworkRule scores requests from clients inside Networks. A positive
+// Points blocks suspicious ranges; a negative one marks trusted ones.
+type NetworkRule struct {
+	Label    string
+	Networks []netip.Prefix
+	Points   int
+}
+
+func (r NetworkRule) Name() string { return r.Label }
+
+func (r NetworkRule) Score(_ context.Context, sig RiskSignals) int {
+	ip, err := netip.ParseAddr(sig.IP)
+	if err != nil {
+		return 0
+	}
+	ip = ip.Unmap()
+	for _, n := range r.Networks {
+		if n.Contains(ip) {
+			return r.Points
+		}
+	}
+	return 0
+}
+
+// UserAgentRule scores clients that send no user agent or one containing
+// any of Patterns, compared case-insensitively.
+type UserAgentRule struct {
+	Patterns []string
+	Points   int
+}
+
+func (r UserAgentRule) Name() string { return "user_agent" }
+
+func (r UserAgentRule) Score(_ context.Context, sig RiskSignals) int {
+	ua := strings.ToLower(sig.UserAgent)
+	if ua == "" {
+		return r.Points
+	}
+	for _, p := range r.Patterns {
+		if strings.Contains(ua, strings.ToLower(p)) {
+			return r.Points
+		}
+	}
+	return 0
+}
+
+// CountryRule scores clients located outside Allowed. An unknown country
+// scores nothing.
+type CountryRule struct {
+	Allowed []string
+	Points  int
+}
+
+func (r CountryRule) Name() string { return "geo" }
+
+func (r CountryRule) Score(_ context.Context, sig RiskSignals) int {
+	if sig.Country == "" || slices.ContainsFunc(r.Allowed, func(c string) bool { return strings.EqualFold(c, sig.Country) }) {
+		return 0
+	}
+	return r.Points
+}
+
+// TimeOfDayRule scores requests made between the hours From and To in
+// Location, UTC when nil. The window wraps midnight when From is after To,
+// so 22 to 6 covers the night.
+type TimeOfDayRule struct {
+	From, To int
+	Location *time.Location
+	Points   int
+}
+
+func (r TimeOfDayRule) Name() string { return "time_of_day" }
+
+func (r TimeOfDayRule) Score(_ context.Context, sig RiskSignals) int {
+	loc := r.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	h := sig.Time.In(loc).Hour()
+	in := h >= r.From && h < r.To
+	if r.From > r.To {
+		in = h >= r.From || h < r.To
+	}
+	if !in {
+		return 0
+	}
+	return r.Points
+}
+
+// NewDeviceRule scores challenges on devices enrolled less than MinAge ago,
+// which an attacker who just paired their own device would use.
+type NewDeviceRule struct {
+	MinAge time.Duration
+	Points int
+}
+
+func (r NewDeviceRule) Name() string { return "device_age" }
+
+func (r NewDeviceRule) Score(_ context.Context, sig RiskSignals) int {
+	if sig.DeviceAge >= r.MinAge {
+		return 0
+	}
+	return r.Points
+}
+
+// RecentFailuresRule scores users with at least Threshold denials since
+// their last approval.
+type RecentFailuresRule struct {
+	Threshold int
+	Points    int
+}
+
+func (r RecentFailuresRule) Name() string { return "recent_failures" }
+
+func (r RecentFailuresRule) Score(_ context.Context, sig RiskSignals) int {
+	if r.Threshold <= 0 || sig.RecentFailures < r.Threshold {
+		return 0
+	}
+	return r.Points
+}
@@ -0,0 +1,56 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// saga runs the steps of a multi-system flow in order and remembers which
+// ones completed. When a later step fails, abort undoes the completed steps
+// in reverse order so neither side is left holding half of the flow.
+type saga struct {
+	name string
+	done []sagaStep
+}
+
+type sagaStep struct {
+	name       string
+	compensate func(ctx context.Context) error
+}
+
+func newSaga(name string) *saga {
+	return &saga{name: name}
+}
+
+// step runs do and, if it succeeds, records compensate as the way to undo it.
+// compensate may be nil for steps that need no undo.
+func (sg *saga) step(ctx context.Context, name string, do, compensate func(ctx context.Context) error) error {
+	if err := do(ctx); err != nil {
+		return err
+	}
+	sg.done = append(sg.done, sagaStep{name: name, compensate: compensate})
+	return nil
+}
+
+// abort compensates every completed step and returns cause joined with any
+// compensation failures. Compensation runs on a context that ignores the
+// caller's cancellation: a client hanging up must not strand the flow.
+func (sg *saga) abort(ctx context.Context, cause error) error {
+	ctx = context.WithoutCancel(ctx)
+	errs := []error{cause}
+	for i := len(sg.done) - 1; i >= 0; i-- {
+		st := sg.done[i]
+		if st.compensate == nil {
+			continue
+		}
+		if err := st.compensate(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s/%s: compensate: %w", sg.name, st.name, err))
+		}
+	}
+	sg.done = nil
+	if len(errs) == 1 {
+		return cause
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,89 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"trustpin_integration/internal/domain"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 appendix B test vectors.
+var rfc6238Secret = []byte("12345678901234567890")
+
+func TestHOTPRFC6238Vectors(t *testing.T) {
+	// The RFC lists eight digits; six-digit codes are their last six.
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		counter := uint64(tt.unix) / uint64(totpPeriod.Seconds())
+		if got := hotp(rfc6238Secret, counter); got != tt.code {
+			t.Errorf("hotp at %d = %s, want %s", tt.unix, got, tt.code)
+		}
+		got, ok := verifyTOTP(rfc6238Secret, tt.code, time.Unix(tt.unix, 0), 0)
+		if !ok || got != counter {
+			t.Errorf("verifyTOTP at %d = %d, %v, want %d, true", tt.unix, got, ok, counter)
+		}
+	}
+}
+
+func TestVerifyTOTPSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	previous := hotp(rfc6238Secret, uint64(now.Unix())/30-1)
+	if _, ok := verifyTOTP(rfc6238Secret, previous, now, 0); ok {
+		t.Error("previous step accepted without skew")
+	}
+	if _, ok := verifyTOTP(rfc6238Secret, previous, now, 1); !ok {
+		t.Error("previous step refused with a skew of one")
+	}
+	for _, code := range []string{"", "12345", "1234567", "000000"} {
+		if _, ok := verifyTOTP(rfc6238Secret, code, now, 1); ok {
+			t.Errorf("code %q accepted", code)
+		}
+	}
+}
+
+func TestCheckTOTPRejectsReplay(t *testing.T) {
+	s := &MFAService{Secrets: plainCipher{}, NonceStore: nonceSet{}, TOTPSkew: 1}
+	d := &domain.MFADevice{ID: "dev-1", TenantID: "t", Secret: string(rfc6238Secret)}
+	code := hotp(rfc6238Secret, uint64(time.Now().Unix())/30)
+
+	if err := s.checkTOTP(context.Background(), d, code); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	err := s.checkTOTP(context.Background(), d, code)
+	if kind, c := Classify(err); kind != ErrConflict || c != "totp_code_reuse" {
+		t.Fatalf("replay: %v", err)
+	}
+	if err := s.checkTOTP(context.Background(), d, "abcdef"); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("wrong code: %v", err)
+	}
+}
+
+// plainCipher stores secrets as they are.
+type plainCipher struct{}
+
+func (plainCipher) Seal(plaintext []byte) (string, error) { return string(plaintext), nil }
+func (plainCipher) Open(sealed string) ([]byte, error)    { return []byte(sealed), nil }
+
+// nonceSet accepts each nonce once.
+type nonceSet map[string]bool
+
+func (n nonceSet) CheckAndSet(ctx context.Context, tenantID domain.TenantID, nonce string, ttl time.Duration) (bool, error) {
+	key := string(tenantID) + ":" + nonce
+	if n[key] {
+		return false, nil
+	}
+	n[key] = true
+	return true, nil
+}
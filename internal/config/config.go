@@ -1,6 +1,7 @@
 package config
 
 import (
+	"encoding/json"
 	"os"
 	"strconv"
 	"strings"
@@ -8,19 +9,107 @@ import (
 )
 
 type Config struct {
-	Env             string
-	Port            string
-	DBDSN           string
-	RedisAddr       string
-	TrustPinBaseURL string
-	TrustPinAPIKey  string
-	JWTIssuer       string
-	JWTAudience     string
-	JWTPublicKeyPEM string
-	JWTPrivateKeyPEM string
-	HTTPTimeout     time.Duration
-	RetryMax        int
-	RetryBackoff    time.Duration
+	Env                string
+	Port               string
+	DBDSN              string
+	RedisAddr          string
+	TrustPinBaseURL    string
+	TrustPinAPIKey     string
+	JWTIssuer          string
+	JWTAudience        string
+	JWTPublicKeyPEM    string
+	JWTPrivateKeyPEM   string
+	HTTPTimeout        time.Duration
+	RequestTimeout     time.Duration
+	StepUpMaxAge       time.Duration
+	RetryMax           int
+	RetryBackoff       time.Duration
+	PairingTTL         time.Duration
+	PairingLinkBase    string
+	CleanupInterval    time.Duration
+	ChallengeSweep     time.Duration
+	AuditCheckpoint    time.Duration
+	OutboxInterval     time.Duration
+	OutboxMaxAttempts  int
+	OutboxBackoff      time.Duration
+	TOTPIssuer         string
+	TOTPSkew           int
+	TOTPEncryptionKey  string
+	WebhookSecret      string
+	TrustProxy         bool
+	NumberMatchTenants []string
+	NumberMatchActions []string
+	ChallengeLimits    ChallengeLimits
+	// TenantChallengeLimits overrides ChallengeLimits per tenant. Fields a
+	// tenant leaves out keep the default.
+	TenantChallengeLimits map[string]ChallengeLimits
+	CountryHeader         string
+	Risk                  RiskConfig
+	// Policy defaults for tenants that do not set their own.
+	ChallengeTTL      time.Duration
+	NonceTTL          time.Duration
+	TokenTTL          time.Duration
+	IdempotencyTTL    time.Duration
+	MFAActions        []string
+	MFAFactors        []string
+	MaxDevicesPerUser int
+	MFAProviders      []string
+	// TrustPinAPIVersion is the Trustpin API version tenants are served
+	// with; TrustPinTenantVersions overrides it per tenant.
+	TrustPinAPIVersion     string
+	TrustPinTenantVersions map[string]string
+}
+
+// RiskConfig configures the risk evaluation of new challenges. Each rule is
+// off until its list, window or threshold is set; the score fields are the
+// points it adds when it fires.
+type RiskConfig struct {
+	AllowBelow          int
+	NumberMatchAt       int
+	DenyAt              int
+	BlockedNetworks     []string
+	BlockedNetworkScore int
+	TrustedNetworks     []string
+	TrustedNetworkScore int
+	UserAgentPatterns   []string
+	UserAgentScore      int
+	AllowedCountries    []string
+	CountryScore        int
+	// OffHours is a UTC hour range such as "22-6".
+	OffHours            string
+	OffHoursScore       int
+	NewDeviceAge        time.Duration
+	NewDeviceScore      int
+	RecentFailures      int
+	RecentFailuresScore int
+}
+
+// ChallengeLimits configures push-bombing protection; zero disables a limit.
+type ChallengeLimits struct {
+	MaxOutstandingPerUser   int      `json:"max_outstanding_per_user"`
+	MaxOutstandingPerDevice int      `json:"max_outstanding_per_device"`
+	MaxRecentPerUser        int      `json:"max_recent_per_user"`
+	MaxRecentPerDevice      int      `json:"max_recent_per_device"`
+	RecentWindow            Duration `json:"recent_window"`
+	MaxConsecutiveDenials   int      `json:"max_consecutive_denials"`
+	LockoutBase             Duration `json:"lockout_base"`
+	LockoutMax              Duration `json:"lockout_max"`
+}
+
+// Duration reads from JSON as a time.ParseDuration string such as "90s".
+type Duration struct{ time.Duration }
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v string
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(v)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
 }
 
 func Load() Config {
@@ -59,20 +148,80 @@ func Load() Config {
 		}
 	}
 
+	limits := ChallengeLimits{
+		MaxOutstandingPerUser:   getInt("CHALLENGE_MAX_OUTSTANDING_PER_USER", 5),
+		MaxOutstandingPerDevice: getInt("CHALLENGE_MAX_OUTSTANDING_PER_DEVICE", 3),
+		MaxRecentPerUser:        getInt("CHALLENGE_MAX_RECENT_PER_USER", 10),
+		MaxRecentPerDevice:      getInt("CHALLENGE_MAX_RECENT_PER_DEVICE", 10),
+		RecentWindow:            Duration{getDuration("CHALLENGE_RECENT_WINDOW", 10*time.Minute)},
+		MaxConsecutiveDenials:   getInt("CHALLENGE_MAX_CONSECUTIVE_DENIALS", 3),
+		LockoutBase:             Duration{getDuration("CHALLENGE_LOCKOUT_BASE", time.Minute)},
+		LockoutMax:              Duration{getDuration("CHALLENGE_LOCKOUT_MAX", time.Hour)},
+	}
+
 	return Config{
-		Env:             getenv("APP_ENV", "dev"),
-		Port:            getenv("PORT", "8083"),
-		DBDSN:           getenv("DB_DSN", ""),
-		RedisAddr:       getenv("REDIS_ADDR", ""),
-		TrustPinBaseURL: getenv("TRUSTPIN_BASE_URL", "http://trustpin.kaizen3.online"),
-		TrustPinAPIKey:  getenv("TRUSTPIN_API_KEY", ""),
-		JWTIssuer:       getenv("JWT_ISSUER", "trustpin"),
-		JWTAudience:     getenv("JWT_AUDIENCE", "mobile"),
-		JWTPublicKeyPEM: normalizePEM(pubPem),
-		JWTPrivateKeyPEM: normalizePEM(privPem),
-		HTTPTimeout:     getDuration("HTTP_TIMEOUT", 5*time.Second),
-		RetryMax:        getInt("RETRY_MAX", 2),
-		RetryBackoff:    getDuration("RETRY_BACKOFF", 200*time.Millisecond),
+		Env:                   getenv("APP_ENV", "dev"),
+		Port:                  getenv("PORT", "8083"),
+		DBDSN:                 getenv("DB_DSN", ""),
+		RedisAddr:             getenv("REDIS_ADDR", ""),
+		TrustPinBaseURL:       getenv("TRUSTPIN_BASE_URL", "http://trustpin.kaizen3.online"),
+		TrustPinAPIKey:        getenv("TRUSTPIN_API_KEY", ""),
+		JWTIssuer:             getenv("JWT_ISSUER", "trustpin"),
+		JWTAudience:           getenv("JWT_AUDIENCE", "mobile"),
+		JWTPublicKeyPEM:       normalizePEM(pubPem),
+		JWTPrivateKeyPEM:      normalizePEM(privPem),
+		HTTPTimeout:           getDuration("HTTP_TIMEOUT", 5*time.Second),
+		RequestTimeout:        getDuration("REQUEST_TIMEOUT", 30*time.Second),
+		StepUpMaxAge:          getDuration("STEP_UP_MAX_AGE", 5*time.Minute),
+		RetryMax:              getInt("RETRY_MAX", 2),
+		RetryBackoff:          getDuration("RETRY_BACKOFF", 200*time.Millisecond),
+		PairingTTL:            getDuration("PAIRING_TTL", 10*time.Minute),
+		PairingLinkBase:       getenv("PAIRING_LINK_BASE", "trustpin://pair"),
+		CleanupInterval:       getDuration("CLEANUP_INTERVAL", time.Minute),
+		ChallengeSweep:        getDuration("CHALLENGE_SWEEP_INTERVAL", 5*time.Second),
+		AuditCheckpoint:       getDuration("AUDIT_CHECKPOINT_INTERVAL", 10*time.Minute),
+		OutboxInterval:        getDuration("OUTBOX_INTERVAL", time.Second),
+		OutboxMaxAttempts:     getInt("OUTBOX_MAX_ATTEMPTS", 8),
+		OutboxBackoff:         getDuration("OUTBOX_BACKOFF", time.Second),
+		TOTPIssuer:            getenv("TOTP_ISSUER", "Trustpin"),
+		TOTPSkew:              getInt("TOTP_SKEW", 1),
+		TOTPEncryptionKey:     getenv("TOTP_ENCRYPTION_KEY", ""),
+		WebhookSecret:         getenv("TRUSTPIN_WEBHOOK_SECRET", ""),
+		TrustProxy:            getBool("TRUST_PROXY_HEADERS", false),
+		NumberMatchTenants:    getList("NUMBER_MATCH_TENANTS"),
+		NumberMatchActions:    getList("NUMBER_MATCH_ACTIONS"),
+		ChallengeLimits:       limits,
+		TenantChallengeLimits: getTenantLimits("CHALLENGE_LIMITS_BY_TENANT", limits),
+		CountryHeader:         getenv("GEO_COUNTRY_HEADER", ""),
+		Risk: RiskConfig{
+			AllowBelow:          getInt("RISK_ALLOW_BELOW", 0),
+			NumberMatchAt:       getInt("RISK_NUMBER_MATCH_AT", 0),
+			DenyAt:              getInt("RISK_DENY_AT", 0),
+			BlockedNetworks:     getList("RISK_BLOCKED_NETWORKS"),
+			BlockedNetworkScore: getInt("RISK_BLOCKED_NETWORK_SCORE", 100),
+			TrustedNetworks:     getList("RISK_TRUSTED_NETWORKS"),
+			TrustedNetworkScore: getInt("RISK_TRUSTED_NETWORK_SCORE", -20),
+			UserAgentPatterns:   getList("RISK_USER_AGENT_PATTERNS"),
+			UserAgentScore:      getInt("RISK_USER_AGENT_SCORE", 20),
+			AllowedCountries:    getList("RISK_ALLOWED_COUNTRIES"),
+			CountryScore:        getInt("RISK_COUNTRY_SCORE", 30),
+			OffHours:            getenv("RISK_OFF_HOURS", ""),
+			OffHoursScore:       getInt("RISK_OFF_HOURS_SCORE", 10),
+			NewDeviceAge:        getDuration("RISK_NEW_DEVICE_AGE", 0),
+			NewDeviceScore:      getInt("RISK_NEW_DEVICE_SCORE", 20),
+			RecentFailures:      getInt("RISK_RECENT_FAILURES", 0),
+			RecentFailuresScore: getInt("RISK_RECENT_FAILURES_SCORE", 30),
+		},
+		ChallengeTTL:           getDuration("CHALLENGE_TTL", 2*time.Minute),
+		NonceTTL:               getDuration("NONCE_TTL", 5*time.Minute),
+		TokenTTL:               getDuration("TOKEN_TTL", 15*time.Minute),
+		IdempotencyTTL:         getDuration("IDEMPOTENCY_TTL", 5*time.Minute),
+		MFAActions:             getList("MFA_ACTIONS"),
+		MFAFactors:             getList("MFA_ALLOWED_FACTORS"),
+		MaxDevicesPerUser:      getInt("MAX_DEVICES_PER_USER", 0),
+		MFAProviders:           getList("MFA_PROVIDERS"),
+		TrustPinAPIVersion:     getenv("TRUSTPIN_API_VERSION", "v1"),
+		TrustPinTenantVersions: getStringMap("TRUSTPIN_API_VERSION_BY_TENANT"),
 	}
 }
 
@@ -108,6 +257,66 @@ func getDuration(key string, def time.Duration) time.Duration {
 	return parsed
 }
 
+func getBool(key string, def bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	parsed, err := strconv.ParseBool(v)
+	if err != nil {
+		return def
+	}
+	return parsed
+}
+
+// getList reads a comma-separated list, dropping empty items.
+func getList(key string) []string {
+	var out []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// getTenantLimits reads a JSON object of tenant ID to limits, e.g.
+// {"acme": {"max_recent_per_user": 3, "lockout_base": "5m"}}. Each tenant
+// starts from def. A malformed value is ignored as a whole.
+func getTenantLimits(key string, def ChallengeLimits) map[string]ChallengeLimits {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(v), &raw); err != nil {
+		return nil
+	}
+	out := make(map[string]ChallengeLimits, len(raw))
+	for tenant, msg := range raw {
+		limits := def
+		if err := json.Unmarshal(msg, &limits); err != nil {
+			return nil
+		}
+		out[tenant] = limits
+	}
+	return out
+}
+
+// getStringMap reads a JSON object of strings, e.g. {"acme": "v2"}. A
+// malformed value is ignored as a whole.
+func getStringMap(key string) map[string]string {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	var out map[string]string
+	if err := json.Unmarshal([]byte(v), &out); err != nil {
+		return nil
+	}
+	return out
+}
+
 func normalizePEM(v string) string {
 	if v == "" {
 		return v
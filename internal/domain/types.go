@@ -1,6 +1,9 @@
 package domain
 
-import "time"
+import (
+	"slices"
+	"time"
+)
 
 type TenantID string
 
@@ -9,9 +12,43 @@ type User struct {
 	TenantID  TenantID
 	Username  string
 	Status    string
+	Roles     []string
 	CreatedAt time.Time
 }
 
+// Roles granting access to tenant administration endpoints.
+const (
+	RoleAdmin   = "admin"
+	RoleAuditor = "auditor"
+)
+
+// HasRole reports whether u holds any of roles.
+func (u *User) HasRole(roles ...string) bool {
+	for _, have := range u.Roles {
+		for _, want := range roles {
+			if have == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// TokenTypeMFAPreAuth is the "typ" claim of a token that only proves the
+// password step of a login. Only the MFA completion endpoint accepts it.
+const TokenTypeMFAPreAuth = "mfa_pre_auth"
+
+// TokenTypeAuditCheckpoint is the "typ" claim of a signed audit chain head.
+// It is not an access token and no endpoint accepts it.
+const TokenTypeAuditCheckpoint = "audit_checkpoint"
+
+// Authentication context class references carried in the "acr" claim,
+// weakest first. Tokens without the claim count as ACRPassword.
+const (
+	ACRPassword    = "aal1"
+	ACRMultiFactor = "aal2"
+)
+
 type Session struct {
 	ID        string
 	TenantID  TenantID
@@ -21,36 +58,269 @@ type Session struct {
 	RevokedAt *time.Time
 }
 
+// Device types. Devices created before types existed have an empty Type and
+// are Trustpin devices.
+const (
+	DeviceTypeTrustPin = "TRUSTPIN"
+	DeviceTypeTOTP     = "TOTP"
+)
+
+// Device lifecycle states.
+const (
+	DeviceStatePending        = "PENDING"
+	DeviceStatePairingPending = "PAIRING_PENDING"
+	DeviceStateActive         = "ACTIVE"
+	DeviceStateRevoked        = "REVOKED"
+)
+
 type MFADevice struct {
-	ID                string
-	TenantID          TenantID
-	UserID            string
-	DeviceName        string
-	PublicKey         string
-	State             string
-	TrustPinEnrollID  string
-	CreatedAt         time.Time
-	UpdatedAt         time.Time
+	ID         string
+	TenantID   TenantID
+	UserID     string
+	Type       string
+	DeviceName string
+	PublicKey  string
+	// Secret holds the sealed shared secret of TOTP devices.
+	Secret           string
+	State            string
+	TrustPinEnrollID string
+	// TrustPinDeviceID is the ID Trustpin assigned on activation. It may
+	// differ from ID, which is the identifier the client enrolled with.
+	TrustPinDeviceID string
+	// PairingExpiresAt bounds how long the device may stay PENDING or
+	// PAIRING_PENDING before it is cleaned up.
+	PairingExpiresAt time.Time
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	// PairingCode holds the sealed Trustpin pairing code while the device is
+	// PAIRING_PENDING, so the pairing QR code can be rendered later.
+	PairingCode string
+	// Primary marks the device the user chose to receive challenges that do
+	// not name a device. At most one device per user is primary.
+	Primary bool
+	// Provider names the factor provider the device was enrolled with.
+	// Devices enrolled before providers were recorded have none and are
+	// served by the tenant's provider for their type.
+	Provider string
 }
 
+// Challenge states. PUSH_SENT and CODE_REQUIRED are open; the rest are
+// terminal.
+const (
+	ChallengeStatePushSent     = "PUSH_SENT"
+	ChallengeStateCodeRequired = "CODE_REQUIRED"
+	ChallengeStateApproved     = "APPROVED"
+	ChallengeStateDenied       = "DENIED"
+	ChallengeStateExpired      = "EXPIRED"
+	ChallengeStateCancelled    = "CANCELLED"
+)
+
 type MFAChallenge struct {
-	ID               string
-	TenantID         TenantID
-	UserID           string
-	DeviceID         string
-	Action           string
-	State            string
+	ID                  string
+	TenantID            TenantID
+	UserID              string
+	DeviceID            string
+	Action              string
+	State               string
 	TrustPinChallengeID string
-	IssuedAt         time.Time
-	ExpiresAt        time.Time
-	UpdatedAt        time.Time
+	IssuedAt            time.Time
+	ExpiresAt           time.Time
+	UpdatedAt           time.Time
+	// NumberMatch is the number the user must pick on the device to approve,
+	// empty when number matching is off for the challenge.
+	NumberMatch string
+	// RiskScore, RiskRules and RiskDecision record the risk evaluation the
+	// challenge was created under: the summed score, the rules that
+	// contributed to it and what the score decided.
+	RiskScore    int
+	RiskRules    []string
+	RiskDecision string
+	// ParentID links a per-device challenge of a fan-out to the logical
+	// challenge the caller sees. The logical challenge has no DeviceID; it
+	// ends when the first of its devices answers.
+	ParentID string
+	// TransactionHash and TransactionText bind a transaction-signing
+	// challenge to the transaction it was created for: the hash of its
+	// canonical JSON, which the approval must sign, and the text the device
+	// displays. Both are empty for other challenges.
+	TransactionHash string
+	TransactionText string
+	// Quorum is the number of approvers who must approve a quorum
+	// challenge; its per-device challenges go to several users. Zero for
+	// other challenges.
+	Quorum int
+}
+
+// Open reports whether c still waits for an answer.
+func (c *MFAChallenge) Open() bool {
+	return c.State == ChallengeStatePushSent || c.State == ChallengeStateCodeRequired
+}
+
+// Challenge transition actors: what moved a challenge to a new state. The
+// reconciler is the outbox dispatcher delivering an approval to Trustpin and
+// recording its answer; the sweeper expires challenges nobody answered.
+const (
+	ChallengeActorUser       = "user"
+	ChallengeActorWebhook    = "webhook"
+	ChallengeActorReconciler = "reconciler"
+	ChallengeActorSweeper    = "sweeper"
+	ChallengeActorRiskEngine = "risk_engine"
+)
+
+// ChallengeTransition records a challenge reaching State: when, what moved
+// it there and the ID tying the change to the request or upstream call
+// behind it, such as the request ID or the idempotency key sent to Trustpin.
+type ChallengeTransition struct {
+	TenantID      TenantID
+	ChallengeID   string
+	State         string
+	Actor         string
+	CorrelationID string
+	At            time.Time
 }
 
+// Risk decisions for a new challenge, from least to most friction. An
+// allowed challenge is approved on creation without reaching the device; a
+// denied one is closed on creation.
+const (
+	RiskDecisionAllow           = "allow"
+	RiskDecisionPush            = "push"
+	RiskDecisionPushNumberMatch = "push_number_match"
+	RiskDecisionDeny            = "deny"
+)
+
+// MFA transaction states.
+const (
+	MFATransactionStatePending   = "PENDING"
+	MFATransactionStateCompleted = "COMPLETED"
+)
+
+// MFATransaction ties a password login to the challenge that has to be
+// approved before the login yields an access token.
+type MFATransaction struct {
+	ID          string
+	TenantID    TenantID
+	UserID      string
+	ChallengeID string
+	State       string
+	ExpiresAt   time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Outbox message states.
+const (
+	OutboxStatePending   = "PENDING"
+	OutboxStateDelivered = "DELIVERED"
+	OutboxStateFailed    = "FAILED"
+)
+
+// OutboxMessage is an upstream operation recorded alongside the local change
+// that requires it and delivered later by the outbox dispatcher.
+type OutboxMessage struct {
+	ID            string
+	TenantID      TenantID
+	Operation     string
+	DedupeKey     string
+	Payload       []byte
+	State         string
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	Result        []byte
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	// RequestID and TraceParent come from the request that enqueued the
+	// message and go with every delivery attempt to the provider.
+	RequestID   string
+	TraceParent string
+	// Deadline is when the enqueueing request gave up waiting. Deliveries
+	// attempted before it are bounded by it; later retries are not, as the
+	// operation must still reach the provider. Zero means no deadline.
+	Deadline time.Time
+}
+
+// RecoveryCode is one single-use code a user can redeem in place of a device.
+// Only the SHA-256 hash of the code is stored.
+type RecoveryCode struct {
+	ID        string
+	TenantID  TenantID
+	UserID    string
+	CodeHash  string
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// AuditLog records one state change or failed operation. RequestID, IP and
+// UserAgent describe the HTTP request that caused it and are empty for
+// background jobs.
+//
+// Each tenant's entries form a hash chain: Seq counts from 1 without gaps,
+// PrevHash is the Hash of the entry before, and Hash covers the entry's
+// content and PrevHash, so editing, dropping or reordering entries breaks
+// the chain.
 type AuditLog struct {
 	ID        string
 	TenantID  TenantID
 	UserID    *string
 	EventType string
 	Payload   string
+	RequestID string
+	IP        string
+	UserAgent string
 	CreatedAt time.Time
+	Seq       int64
+	PrevHash  string
+	Hash      string
+}
+
+// AuditCheckpoint is a signed statement that a tenant's audit chain had the
+// given head. Truncating the chain below a checkpoint is detectable.
+type AuditCheckpoint struct {
+	TenantID  TenantID
+	Seq       int64
+	Hash      string
+	Signature string
+	CreatedAt time.Time
+}
+
+// TenantPolicy is a tenant's MFA configuration. Zero fields keep the
+// service defaults.
+type TenantPolicy struct {
+	TenantID TenantID
+	// MFAActions are the actions that require a challenge. Only "login" is
+	// recognised: password logins ask for MFA when it is listed or the list
+	// is empty.
+	MFAActions []string
+	// AllowedFactors are the device types users may enroll and be
+	// challenged on. Empty allows all.
+	AllowedFactors        []string
+	MaxDevicesPerUser     int
+	ChallengeTTL          time.Duration
+	NonceTTL              time.Duration
+	TokenTTL              time.Duration
+	IdempotencyTTL        time.Duration
+	MaxConsecutiveDenials int
+	LockoutBase           time.Duration
+	LockoutMax            time.Duration
+	UpdatedAt             time.Time
+	// Providers lists the factor providers in order of preference: each
+	// device type is served by the first provider for it, and the ones
+	// after it take over when it is unavailable. Empty uses every
+	// registered provider in registration order.
+	Providers []string
+}
+
+// RequiresMFA reports whether the policy asks for a challenge before
+// action. Only logins consult it.
+func (p *TenantPolicy) RequiresMFA(action string) bool {
+	return len(p.MFAActions) == 0 || slices.Contains(p.MFAActions, action)
+}
+
+// AllowsFactor reports whether devices of deviceType may be used.
+func (p *TenantPolicy) AllowsFactor(deviceType string) bool {
+	if deviceType == "" {
+		deviceType = DeviceTypeTrustPin
+	}
+	return len(p.AllowedFactors) == 0 || slices.Contains(p.AllowedFactors, deviceType)
 }
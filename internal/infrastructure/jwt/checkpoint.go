@@ -0,0 +1,61 @@
+package jwt
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"trustpin_integration/internal/domain"
+)
+
+// SignAuditCheckpoint signs an audit chain head as a JWT. The token has no
+// audience or expiry and a "typ" claim that keeps it from being used as an
+// access token.
+func (i *Issuer) SignAuditCheckpoint(cp *domain.AuditCheckpoint) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":       i.issuer,
+		"typ":       domain.TokenTypeAuditCheckpoint,
+		"tenant_id": string(cp.TenantID),
+		"seq":       cp.Seq,
+		"hash":      cp.Hash,
+		"iat":       cp.CreatedAt.Unix(),
+	})
+	return token.SignedString(i.privateKey)
+}
+
+// CheckpointVerifier checks audit checkpoints against the service's public
+// key, e.g. in the verify-audit command.
+type CheckpointVerifier struct {
+	publicKey *rsa.PublicKey
+	issuer    string
+}
+
+func NewCheckpointVerifier(publicKeyPEM, issuer string) (*CheckpointVerifier, error) {
+	pub, err := jwt.ParseRSAPublicKeyFromPEM([]byte(publicKeyPEM))
+	if err != nil {
+		return nil, err
+	}
+	return &CheckpointVerifier{publicKey: pub, issuer: issuer}, nil
+}
+
+func (v *CheckpointVerifier) VerifyAuditCheckpoint(cp *domain.AuditCheckpoint) error {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(cp.Signature, claims, func(t *jwt.Token) (any, error) {
+		return v.publicKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}), jwt.WithIssuer(v.issuer))
+	if err != nil {
+		return err
+	}
+	if typ, _ := claims["typ"].(string); typ != domain.TokenTypeAuditCheckpoint {
+		return errors.New("not an audit checkpoint")
+	}
+	tenantID, _ := claims["tenant_id"].(string)
+	seq, _ := claims["seq"].(float64)
+	hash, _ := claims["hash"].(string)
+	if tenantID != string(cp.TenantID) || int64(seq) != cp.Seq || hash != cp.Hash {
+		return fmt.Errorf("signed head is tenant %q seq %d hash %s", tenantID, int64(seq), hash)
+	}
+	return nil
+}
@@ -6,8 +6,14 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+
+	"trustpin_integration/internal/application"
+	"trustpin_integration/internal/domain"
 )
 
+// preAuthTTL is kept short: the token is only good for finishing MFA.
+const preAuthTTL = 5 * time.Minute
+
 type Issuer struct {
 	privateKey *rsa.PrivateKey
 	issuer     string
@@ -23,8 +29,44 @@ func NewIssuer(privateKeyPEM, issuer, audience string, ttl time.Duration) (*Issu
 	return &Issuer{privateKey: pk, issuer: issuer, audience: audience, ttl: ttl}, nil
 }
 
-func (i *Issuer) Issue(ctx context.Context, tenantID, userID string) (string, time.Time, error) {
-	exp := time.Now().Add(i.ttl)
+// Issue issues an access token valid for ttl, or for the issuer's default
+// lifetime when ttl is zero.
+func (i *Issuer) Issue(ctx context.Context, tenantID, userID string, ttl time.Duration) (string, time.Time, error) {
+	return i.sign(tenantID, userID, i.accessTTL(ttl), nil)
+}
+
+// IssueElevated issues an access token that also records the MFA the user
+// passed, for routes that demand a minimum acr or a recent auth_time.
+func (i *Issuer) IssueElevated(ctx context.Context, tenantID, userID string, e *application.Elevation, ttl time.Duration) (string, time.Time, error) {
+	extra := jwt.MapClaims{
+		"acr":       e.ACR,
+		"amr":       e.AMR,
+		"auth_time": e.AuthTime.Unix(),
+	}
+	if e.Action != "" {
+		extra["action"] = e.Action
+	}
+	return i.sign(tenantID, userID, i.accessTTL(ttl), extra)
+}
+
+func (i *Issuer) accessTTL(ttl time.Duration) time.Duration {
+	if ttl > 0 {
+		return ttl
+	}
+	return i.ttl
+}
+
+// IssuePreAuth issues the token a user holds between the password step and
+// completing MFA for the given transaction.
+func (i *Issuer) IssuePreAuth(ctx context.Context, tenantID, userID, transactionID string) (string, time.Time, error) {
+	return i.sign(tenantID, userID, preAuthTTL, jwt.MapClaims{
+		"typ":                domain.TokenTypeMFAPreAuth,
+		"mfa_transaction_id": transactionID,
+	})
+}
+
+func (i *Issuer) sign(tenantID, userID string, ttl time.Duration, extra jwt.MapClaims) (string, time.Time, error) {
+	exp := time.Now().Add(ttl)
 	claims := jwt.MapClaims{
 		"sub":       userID,
 		"tenant_id": tenantID,
@@ -34,6 +76,9 @@ func (i *Issuer) Issue(ctx context.Context, tenantID, userID string) (string, ti
 		"iat":       time.Now().Unix(),
 		"jti":       jwt.NewNumericDate(time.Now()).String(),
 	}
+	for k, v := range extra {
+		claims[k] = v
+	}
 	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
 	signed, err := token.SignedString(i.privateKey)
 	if err != nil {
@@ -0,0 +1,124 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"trustpin_integration/internal/application"
+	"trustpin_integration/internal/domain"
+)
+
+type txCtxKey struct{}
+
+// TxManager serializes transactional work. The in-memory repositories cannot
+// roll back, so writes made before fn fails stay in place; this backend is
+// meant for local development. Nested calls join the outer transaction.
+type TxManager struct {
+	mu sync.Mutex
+}
+
+func NewTxManager() *TxManager {
+	return &TxManager{}
+}
+
+func (t *TxManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx.Value(txCtxKey{}) != nil {
+		return fn(ctx)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return fn(context.WithValue(ctx, txCtxKey{}, true))
+}
+
+type OutboxStore struct {
+	mu       sync.Mutex
+	messages map[string]*domain.OutboxMessage
+	dedupe   map[string]string
+}
+
+func NewOutboxStore() *OutboxStore {
+	return &OutboxStore{messages: make(map[string]*domain.OutboxMessage), dedupe: make(map[string]string)}
+}
+
+func (s *OutboxStore) Enqueue(ctx context.Context, m *domain.OutboxMessage) (*domain.OutboxMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := string(m.TenantID) + ":" + m.DedupeKey
+	if id, ok := s.dedupe[key]; ok && m.DedupeKey != "" {
+		existing := *s.messages[id]
+		return &existing, nil
+	}
+	stored := *m
+	s.messages[m.ID] = &stored
+	if m.DedupeKey != "" {
+		s.dedupe[key] = m.ID
+	}
+	out := stored
+	return &out, nil
+}
+
+func (s *OutboxStore) GetByID(ctx context.Context, id string) (*domain.OutboxMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.messages[id]
+	if !ok {
+		return nil, nil
+	}
+	out := *m
+	return &out, nil
+}
+
+func (s *OutboxStore) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*domain.OutboxMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []*domain.OutboxMessage
+	for _, m := range s.messages {
+		if len(out) >= limit {
+			break
+		}
+		if m.State != domain.OutboxStatePending || m.NextAttemptAt.After(now) {
+			continue
+		}
+		m.NextAttemptAt = now.Add(lease)
+		claimed := *m
+		out = append(out, &claimed)
+	}
+	return out, nil
+}
+
+func (s *OutboxStore) MarkDelivered(ctx context.Context, id string, result []byte) error {
+	return s.update(id, func(m *domain.OutboxMessage) {
+		m.State = domain.OutboxStateDelivered
+		m.Result = result
+		m.Attempts++
+	})
+}
+
+func (s *OutboxStore) MarkRetry(ctx context.Context, id, lastErr string, next time.Time) error {
+	return s.update(id, func(m *domain.OutboxMessage) {
+		m.LastError = lastErr
+		m.NextAttemptAt = next
+		m.Attempts++
+	})
+}
+
+func (s *OutboxStore) MarkFailed(ctx context.Context, id, lastErr string) error {
+	return s.update(id, func(m *domain.OutboxMessage) {
+		m.State = domain.OutboxStateFailed
+		m.LastError = lastErr
+		m.Attempts++
+	})
+}
+
+func (s *OutboxStore) update(id string, fn func(m *domain.OutboxMessage)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.messages[id]
+	if !ok {
+		return application.NotFound("outbox_message", id)
+	}
+	fn(m)
+	m.UpdatedAt = time.Now()
+	return nil
+}
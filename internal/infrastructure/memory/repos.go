@@ -2,10 +2,12 @@ package memory
 
 import (
 	"context"
-	"errors"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 
+	"trustpin_integration/internal/application"
 	"trustpin_integration/internal/domain"
 )
 
@@ -79,7 +81,7 @@ func (r *DeviceRepo) Create(ctx context.Context, d *domain.MFADevice) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	if _, ok := r.devices[d.ID]; ok {
-		return errors.New("device_exists")
+		return application.Conflict("device_exists", "device", d.ID)
 	}
 	r.devices[d.ID] = d
 	return nil
@@ -95,18 +97,142 @@ func (r *DeviceRepo) GetByID(ctx context.Context, tenantID domain.TenantID, id s
 	return d, nil
 }
 
+func (r *DeviceRepo) GetByTrustPinDeviceID(ctx context.Context, tenantID domain.TenantID, trustPinDeviceID string) (*domain.MFADevice, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, d := range r.devices {
+		if d.TenantID == tenantID && d.TrustPinDeviceID != "" && d.TrustPinDeviceID == trustPinDeviceID {
+			return d, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *DeviceRepo) GetByTrustPinEnrollID(ctx context.Context, tenantID domain.TenantID, enrollID string) (*domain.MFADevice, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, d := range r.devices {
+		if d.TenantID == tenantID && d.TrustPinEnrollID != "" && d.TrustPinEnrollID == enrollID {
+			return d, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *DeviceRepo) Update(ctx context.Context, d *domain.MFADevice) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cur, ok := r.devices[d.ID]
+	if !ok || cur.TenantID != d.TenantID {
+		return application.NotFound("device", d.ID)
+	}
+	cur.DeviceName = d.DeviceName
+	cur.PublicKey = d.PublicKey
+	cur.State = d.State
+	cur.TrustPinEnrollID = d.TrustPinEnrollID
+	cur.TrustPinDeviceID = d.TrustPinDeviceID
+	cur.PairingExpiresAt = d.PairingExpiresAt
+	cur.PairingCode = d.PairingCode
+	cur.UpdatedAt = time.Now()
+	return nil
+}
+
 func (r *DeviceRepo) UpdateState(ctx context.Context, tenantID domain.TenantID, id, state string) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	d, ok := r.devices[id]
 	if !ok || d.TenantID != tenantID {
-		return errors.New("not_found")
+		return application.NotFound("device", id)
 	}
 	d.State = state
 	d.UpdatedAt = time.Now()
 	return nil
 }
 
+func (r *DeviceRepo) UpdateName(ctx context.Context, tenantID domain.TenantID, id, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d, ok := r.devices[id]
+	if !ok || d.TenantID != tenantID {
+		return application.NotFound("device", id)
+	}
+	d.DeviceName = name
+	d.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *DeviceRepo) SetPrimary(ctx context.Context, tenantID domain.TenantID, userID, deviceID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if deviceID != "" {
+		d, ok := r.devices[deviceID]
+		if !ok || d.TenantID != tenantID || d.UserID != userID {
+			return application.NotFound("device", deviceID)
+		}
+	}
+	now := time.Now()
+	for _, d := range r.devices {
+		if d.TenantID != tenantID || d.UserID != userID || d.Primary == (d.ID == deviceID) {
+			continue
+		}
+		d.Primary = d.ID == deviceID
+		d.UpdatedAt = now
+	}
+	return nil
+}
+
+func (r *DeviceRepo) ListByUser(ctx context.Context, tenantID domain.TenantID, userID string, offset, limit int) ([]*domain.MFADevice, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var all []*domain.MFADevice
+	for _, d := range r.devices {
+		if d.TenantID == tenantID && d.UserID == userID {
+			all = append(all, d)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].CreatedAt.Equal(all[j].CreatedAt) {
+			return all[i].ID < all[j].ID
+		}
+		return all[i].CreatedAt.Before(all[j].CreatedAt)
+	})
+	total := len(all)
+	if offset >= total {
+		return nil, total, nil
+	}
+	end := offset + limit
+	if limit <= 0 || end > total {
+		end = total
+	}
+	return all[offset:end], total, nil
+}
+
+func (r *DeviceRepo) Delete(ctx context.Context, tenantID domain.TenantID, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d, ok := r.devices[id]
+	if !ok || d.TenantID != tenantID {
+		return application.NotFound("device", id)
+	}
+	delete(r.devices, id)
+	return nil
+}
+
+func (r *DeviceRepo) ListExpiredPairings(ctx context.Context, before time.Time) ([]*domain.MFADevice, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []*domain.MFADevice
+	for _, d := range r.devices {
+		if d.State != domain.DeviceStatePending && d.State != domain.DeviceStatePairingPending {
+			continue
+		}
+		if d.PairingExpiresAt.Before(before) {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
 type ChallengeRepo struct {
 	mu         sync.RWMutex
 	challenges map[string]*domain.MFAChallenge
@@ -130,7 +256,8 @@ func (r *ChallengeRepo) GetByID(ctx context.Context, tenantID domain.TenantID, i
 	if !ok || c.TenantID != tenantID {
 		return nil, nil
 	}
-	return c, nil
+	cp := *c
+	return &cp, nil
 }
 
 func (r *ChallengeRepo) UpdateState(ctx context.Context, tenantID domain.TenantID, id, state string) error {
@@ -138,9 +265,328 @@ func (r *ChallengeRepo) UpdateState(ctx context.Context, tenantID domain.TenantI
 	defer r.mu.Unlock()
 	c, ok := r.challenges[id]
 	if !ok || c.TenantID != tenantID {
-		return errors.New("not_found")
+		return application.NotFound("challenge", id)
+	}
+	c.State = state
+	c.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *ChallengeRepo) ListByDevice(ctx context.Context, tenantID domain.TenantID, deviceID string) ([]*domain.MFAChallenge, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []*domain.MFAChallenge
+	for _, c := range r.challenges {
+		if c.TenantID == tenantID && c.DeviceID == deviceID {
+			cp := *c
+			out = append(out, &cp)
+		}
+	}
+	return out, nil
+}
+
+func (r *ChallengeRepo) ListByParent(ctx context.Context, tenantID domain.TenantID, parentID string) ([]*domain.MFAChallenge, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []*domain.MFAChallenge
+	for _, c := range r.challenges {
+		if c.TenantID == tenantID && c.ParentID != "" && c.ParentID == parentID {
+			cp := *c
+			out = append(out, &cp)
+		}
+	}
+	return out, nil
+}
+
+func (r *ChallengeRepo) Close(ctx context.Context, tenantID domain.TenantID, id, state string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.challenges[id]
+	if !ok || c.TenantID != tenantID {
+		return false, application.NotFound("challenge", id)
+	}
+	if c.State != domain.ChallengeStatePushSent && c.State != domain.ChallengeStateCodeRequired {
+		return false, nil
 	}
 	c.State = state
 	c.UpdatedAt = time.Now()
+	return true, nil
+}
+
+func (r *ChallengeRepo) ListOpenByUser(ctx context.Context, tenantID domain.TenantID, userID string, now time.Time) ([]*domain.MFAChallenge, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []*domain.MFAChallenge
+	for _, c := range r.challenges {
+		if c.TenantID != tenantID || c.UserID != userID || !c.ExpiresAt.After(now) {
+			continue
+		}
+		if c.State == domain.ChallengeStatePushSent || c.State == domain.ChallengeStateCodeRequired {
+			cp := *c
+			out = append(out, &cp)
+		}
+	}
+	return out, nil
+}
+
+func (r *ChallengeRepo) ExpireOpen(ctx context.Context, now time.Time) ([]*domain.MFAChallenge, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []*domain.MFAChallenge
+	for _, c := range r.challenges {
+		if c.ExpiresAt.After(now) {
+			continue
+		}
+		if c.State == domain.ChallengeStatePushSent || c.State == domain.ChallengeStateCodeRequired {
+			c.State = domain.ChallengeStateExpired
+			c.UpdatedAt = now
+			cp := *c
+			out = append(out, &cp)
+		}
+	}
+	return out, nil
+}
+
+type ChallengeHistoryRepo struct {
+	mu          sync.RWMutex
+	transitions map[string][]domain.ChallengeTransition
+}
+
+func NewChallengeHistoryRepo() *ChallengeHistoryRepo {
+	return &ChallengeHistoryRepo{transitions: make(map[string][]domain.ChallengeTransition)}
+}
+
+func (r *ChallengeHistoryRepo) Append(ctx context.Context, t *domain.ChallengeTransition) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := string(t.TenantID) + ":" + t.ChallengeID
+	r.transitions[key] = append(r.transitions[key], *t)
+	return nil
+}
+
+func (r *ChallengeHistoryRepo) List(ctx context.Context, tenantID domain.TenantID, challengeID string) ([]*domain.ChallengeTransition, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	stored := r.transitions[string(tenantID)+":"+challengeID]
+	out := make([]*domain.ChallengeTransition, len(stored))
+	for i := range stored {
+		t := stored[i]
+		out[i] = &t
+	}
+	return out, nil
+}
+
+type RecoveryCodeRepo struct {
+	mu    sync.Mutex
+	codes map[string][]*domain.RecoveryCode
+}
+
+func NewRecoveryCodeRepo() *RecoveryCodeRepo {
+	return &RecoveryCodeRepo{codes: make(map[string][]*domain.RecoveryCode)}
+}
+
+func (r *RecoveryCodeRepo) ReplaceForUser(ctx context.Context, tenantID domain.TenantID, userID string, codes []*domain.RecoveryCode) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := make([]*domain.RecoveryCode, len(codes))
+	for i, c := range codes {
+		cp := *c
+		stored[i] = &cp
+	}
+	r.codes[string(tenantID)+":"+userID] = stored
+	return nil
+}
+
+func (r *RecoveryCodeRepo) Consume(ctx context.Context, tenantID domain.TenantID, userID, codeHash string, usedAt time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.codes[string(tenantID)+":"+userID] {
+		if c.CodeHash == codeHash && c.UsedAt == nil {
+			c.UsedAt = &usedAt
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type AuditRepo struct {
+	mu          sync.Mutex
+	entries     []*domain.AuditLog
+	heads       map[domain.TenantID]*domain.AuditLog
+	checkpoints map[domain.TenantID][]*domain.AuditCheckpoint
+}
+
+func NewAuditRepo() *AuditRepo {
+	return &AuditRepo{
+		heads:       make(map[domain.TenantID]*domain.AuditLog),
+		checkpoints: make(map[domain.TenantID][]*domain.AuditCheckpoint),
+	}
+}
+
+func (r *AuditRepo) Append(ctx context.Context, entry *domain.AuditLog) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	application.ChainAuditEntry(r.heads[entry.TenantID], entry)
+	cp := *entry
+	r.entries = append(r.entries, &cp)
+	r.heads[entry.TenantID] = &cp
+	return nil
+}
+
+func (r *AuditRepo) Chain(ctx context.Context, tenantID domain.TenantID) ([]*domain.AuditLog, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []*domain.AuditLog
+	for _, e := range r.entries {
+		if e.TenantID == tenantID {
+			cp := *e
+			out = append(out, &cp)
+		}
+	}
+	return out, nil
+}
+
+func (r *AuditRepo) Heads(ctx context.Context) ([]*domain.AuditLog, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]*domain.AuditLog, 0, len(r.heads))
+	for _, h := range r.heads {
+		cp := *h
+		out = append(out, &cp)
+	}
+	return out, nil
+}
+
+func (r *AuditRepo) SaveCheckpoint(ctx context.Context, cp *domain.AuditCheckpoint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := *cp
+	r.checkpoints[cp.TenantID] = append(r.checkpoints[cp.TenantID], &c)
+	return nil
+}
+
+func (r *AuditRepo) Checkpoints(ctx context.Context, tenantID domain.TenantID) ([]*domain.AuditCheckpoint, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]*domain.AuditCheckpoint, 0, len(r.checkpoints[tenantID]))
+	for _, c := range r.checkpoints[tenantID] {
+		cp := *c
+		out = append(out, &cp)
+	}
+	return out, nil
+}
+
+func (r *AuditRepo) List(ctx context.Context, tenantID domain.TenantID, f application.AuditFilter, offset, limit int) ([]*domain.AuditLog, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var matched []*domain.AuditLog
+	for i := len(r.entries) - 1; i >= 0; i-- {
+		e := r.entries[i]
+		if e.TenantID != tenantID || !auditMatches(e, f) {
+			continue
+		}
+		matched = append(matched, e)
+	}
+	total := len(matched)
+	if offset >= total {
+		return nil, total, nil
+	}
+	end := offset + limit
+	if limit <= 0 || end > total {
+		end = total
+	}
+	out := make([]*domain.AuditLog, 0, end-offset)
+	for _, e := range matched[offset:end] {
+		cp := *e
+		out = append(out, &cp)
+	}
+	return out, total, nil
+}
+
+func auditMatches(e *domain.AuditLog, f application.AuditFilter) bool {
+	if f.UserID != "" && (e.UserID == nil || *e.UserID != f.UserID) {
+		return false
+	}
+	if f.EventType != "" && e.EventType != f.EventType {
+		return false
+	}
+	if !f.From.IsZero() && e.CreatedAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !e.CreatedAt.Before(f.To) {
+		return false
+	}
+	return true
+}
+
+type MFATransactionRepo struct {
+	mu           sync.Mutex
+	transactions map[string]*domain.MFATransaction
+}
+
+func NewMFATransactionRepo() *MFATransactionRepo {
+	return &MFATransactionRepo{transactions: make(map[string]*domain.MFATransaction)}
+}
+
+func (r *MFATransactionRepo) Create(ctx context.Context, t *domain.MFATransaction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cp := *t
+	r.transactions[t.ID] = &cp
+	return nil
+}
+
+func (r *MFATransactionRepo) GetByID(ctx context.Context, tenantID domain.TenantID, id string) (*domain.MFATransaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.transactions[id]
+	if !ok || t.TenantID != tenantID {
+		return nil, nil
+	}
+	cp := *t
+	return &cp, nil
+}
+
+func (r *MFATransactionRepo) Complete(ctx context.Context, tenantID domain.TenantID, id string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.transactions[id]
+	if !ok || t.TenantID != tenantID || t.State != domain.MFATransactionStatePending {
+		return false, nil
+	}
+	t.State = domain.MFATransactionStateCompleted
+	t.UpdatedAt = time.Now()
+	return true, nil
+}
+
+type TenantPolicyRepo struct {
+	mu       sync.RWMutex
+	policies map[domain.TenantID]*domain.TenantPolicy
+}
+
+func NewTenantPolicyRepo() *TenantPolicyRepo {
+	return &TenantPolicyRepo{policies: make(map[domain.TenantID]*domain.TenantPolicy)}
+}
+
+func (r *TenantPolicyRepo) Get(ctx context.Context, tenantID domain.TenantID) (*domain.TenantPolicy, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.policies[tenantID]
+	if !ok {
+		return nil, nil
+	}
+	cp := *p
+	cp.MFAActions = slices.Clone(p.MFAActions)
+	cp.AllowedFactors = slices.Clone(p.AllowedFactors)
+	return &cp, nil
+}
+
+func (r *TenantPolicyRepo) Save(ctx context.Context, p *domain.TenantPolicy) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cp := *p
+	cp.MFAActions = slices.Clone(p.MFAActions)
+	cp.AllowedFactors = slices.Clone(p.AllowedFactors)
+	r.policies[p.TenantID] = &cp
 	return nil
 }
@@ -64,3 +64,55 @@ func (s *IdempotencyStore) Set(ctx context.Context, tenantID domain.TenantID, ke
 	s.items[k] = idempotentItem{value: value, exp: time.Now().Add(ttl)}
 	return nil
 }
+
+type CounterStore struct {
+	mu    sync.Mutex
+	items map[string]counterItem
+}
+
+type counterItem struct {
+	value int64
+	exp   time.Time
+}
+
+func NewCounterStore() *CounterStore {
+	return &CounterStore{items: make(map[string]counterItem)}
+}
+
+func (s *CounterStore) Incr(ctx context.Context, tenantID domain.TenantID, key string, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := string(tenantID) + ":" + key
+	now := time.Now()
+	item, ok := s.items[k]
+	if !ok || !now.Before(item.exp) {
+		item = counterItem{exp: now.Add(ttl)}
+	}
+	item.value++
+	s.items[k] = item
+	return item.value, nil
+}
+
+func (s *CounterStore) Get(ctx context.Context, tenantID domain.TenantID, key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.items[string(tenantID)+":"+key]
+	if !ok || !time.Now().Before(item.exp) {
+		return 0, nil
+	}
+	return item.value, nil
+}
+
+func (s *CounterStore) Set(ctx context.Context, tenantID domain.TenantID, key string, value int64, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[string(tenantID)+":"+key] = counterItem{value: value, exp: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *CounterStore) Delete(ctx context.Context, tenantID domain.TenantID, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, string(tenantID)+":"+key)
+	return nil
+}
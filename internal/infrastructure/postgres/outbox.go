@@ -0,0 +1,41 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"trustpin_integration/internal/domain"
+)
+
+type TxManager struct{}
+
+type OutboxStore struct{}
+
+func (t *TxManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return errors.New("not_implemented")
+}
+
+func (s *OutboxStore) Enqueue(ctx context.Context, m *domain.OutboxMessage) (*domain.OutboxMessage, error) {
+	return nil, errors.New("not_implemented")
+}
+
+func (s *OutboxStore) GetByID(ctx context.Context, id string) (*domain.OutboxMessage, error) {
+	return nil, errors.New("not_implemented")
+}
+
+func (s *OutboxStore) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*domain.OutboxMessage, error) {
+	return nil, errors.New("not_implemented")
+}
+
+func (s *OutboxStore) MarkDelivered(ctx context.Context, id string, result []byte) error {
+	return errors.New("not_implemented")
+}
+
+func (s *OutboxStore) MarkRetry(ctx context.Context, id, lastErr string, next time.Time) error {
+	return errors.New("not_implemented")
+}
+
+func (s *OutboxStore) MarkFailed(ctx context.Context, id, lastErr string) error {
+	return errors.New("not_implemented")
+}
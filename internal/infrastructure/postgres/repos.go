@@ -5,6 +5,7 @@ import (
 	"errors"
 	"time"
 
+	"trustpin_integration/internal/application"
 	"trustpin_integration/internal/domain"
 )
 
@@ -40,10 +41,42 @@ func (r *DeviceRepo) GetByID(ctx context.Context, tenantID domain.TenantID, id s
 	return nil, errors.New("not_implemented")
 }
 
+func (r *DeviceRepo) GetByTrustPinDeviceID(ctx context.Context, tenantID domain.TenantID, trustPinDeviceID string) (*domain.MFADevice, error) {
+	return nil, errors.New("not_implemented")
+}
+
+func (r *DeviceRepo) GetByTrustPinEnrollID(ctx context.Context, tenantID domain.TenantID, enrollID string) (*domain.MFADevice, error) {
+	return nil, errors.New("not_implemented")
+}
+
+func (r *DeviceRepo) Update(ctx context.Context, d *domain.MFADevice) error {
+	return errors.New("not_implemented")
+}
+
 func (r *DeviceRepo) UpdateState(ctx context.Context, tenantID domain.TenantID, id, state string) error {
 	return errors.New("not_implemented")
 }
 
+func (r *DeviceRepo) UpdateName(ctx context.Context, tenantID domain.TenantID, id, name string) error {
+	return errors.New("not_implemented")
+}
+
+func (r *DeviceRepo) SetPrimary(ctx context.Context, tenantID domain.TenantID, userID, deviceID string) error {
+	return errors.New("not_implemented")
+}
+
+func (r *DeviceRepo) ListByUser(ctx context.Context, tenantID domain.TenantID, userID string, offset, limit int) ([]*domain.MFADevice, int, error) {
+	return nil, 0, errors.New("not_implemented")
+}
+
+func (r *DeviceRepo) Delete(ctx context.Context, tenantID domain.TenantID, id string) error {
+	return errors.New("not_implemented")
+}
+
+func (r *DeviceRepo) ListExpiredPairings(ctx context.Context, before time.Time) ([]*domain.MFADevice, error) {
+	return nil, errors.New("not_implemented")
+}
+
 func (r *ChallengeRepo) Create(ctx context.Context, c *domain.MFAChallenge) error {
 	return errors.New("not_implemented")
 }
@@ -55,3 +88,93 @@ func (r *ChallengeRepo) GetByID(ctx context.Context, tenantID domain.TenantID, i
 func (r *ChallengeRepo) UpdateState(ctx context.Context, tenantID domain.TenantID, id, state string) error {
 	return errors.New("not_implemented")
 }
+
+func (r *ChallengeRepo) ListByDevice(ctx context.Context, tenantID domain.TenantID, deviceID string) ([]*domain.MFAChallenge, error) {
+	return nil, errors.New("not_implemented")
+}
+
+func (r *ChallengeRepo) ListByParent(ctx context.Context, tenantID domain.TenantID, parentID string) ([]*domain.MFAChallenge, error) {
+	return nil, errors.New("not_implemented")
+}
+
+func (r *ChallengeRepo) Close(ctx context.Context, tenantID domain.TenantID, id, state string) (bool, error) {
+	return false, errors.New("not_implemented")
+}
+
+func (r *ChallengeRepo) ListOpenByUser(ctx context.Context, tenantID domain.TenantID, userID string, now time.Time) ([]*domain.MFAChallenge, error) {
+	return nil, errors.New("not_implemented")
+}
+
+func (r *ChallengeRepo) ExpireOpen(ctx context.Context, now time.Time) ([]*domain.MFAChallenge, error) {
+	return nil, errors.New("not_implemented")
+}
+
+type ChallengeHistoryRepo struct{}
+
+func (r *ChallengeHistoryRepo) Append(ctx context.Context, t *domain.ChallengeTransition) error {
+	return errors.New("not_implemented")
+}
+
+func (r *ChallengeHistoryRepo) List(ctx context.Context, tenantID domain.TenantID, challengeID string) ([]*domain.ChallengeTransition, error) {
+	return nil, errors.New("not_implemented")
+}
+
+type RecoveryCodeRepo struct{}
+
+type AuditRepo struct{}
+
+func (r *RecoveryCodeRepo) ReplaceForUser(ctx context.Context, tenantID domain.TenantID, userID string, codes []*domain.RecoveryCode) error {
+	return errors.New("not_implemented")
+}
+
+func (r *RecoveryCodeRepo) Consume(ctx context.Context, tenantID domain.TenantID, userID, codeHash string, usedAt time.Time) (bool, error) {
+	return false, errors.New("not_implemented")
+}
+
+func (r *AuditRepo) Append(ctx context.Context, entry *domain.AuditLog) error {
+	return errors.New("not_implemented")
+}
+
+func (r *AuditRepo) List(ctx context.Context, tenantID domain.TenantID, f application.AuditFilter, offset, limit int) ([]*domain.AuditLog, int, error) {
+	return nil, 0, errors.New("not_implemented")
+}
+
+func (r *AuditRepo) Chain(ctx context.Context, tenantID domain.TenantID) ([]*domain.AuditLog, error) {
+	return nil, errors.New("not_implemented")
+}
+
+func (r *AuditRepo) Heads(ctx context.Context) ([]*domain.AuditLog, error) {
+	return nil, errors.New("not_implemented")
+}
+
+func (r *AuditRepo) SaveCheckpoint(ctx context.Context, cp *domain.AuditCheckpoint) error {
+	return errors.New("not_implemented")
+}
+
+func (r *AuditRepo) Checkpoints(ctx context.Context, tenantID domain.TenantID) ([]*domain.AuditCheckpoint, error) {
+	return nil, errors.New("not_implemented")
+}
+
+type MFATransactionRepo struct{}
+
+func (r *MFATransactionRepo) Create(ctx context.Context, t *domain.MFATransaction) error {
+	return errors.New("not_implemented")
+}
+
+func (r *MFATransactionRepo) GetByID(ctx context.Context, tenantID domain.TenantID, id string) (*domain.MFATransaction, error) {
+	return nil, errors.New("not_implemented")
+}
+
+func (r *MFATransactionRepo) Complete(ctx context.Context, tenantID domain.TenantID, id string) (bool, error) {
+	return false, errors.New("not_implemented")
+}
+
+type TenantPolicyRepo struct{}
+
+func (r *TenantPolicyRepo) Get(ctx context.Context, tenantID domain.TenantID) (*domain.TenantPolicy, error) {
+	return nil, errors.New("not_implemented")
+}
+
+func (r *TenantPolicyRepo) Save(ctx context.Context, p *domain.TenantPolicy) error {
+	return errors.New("not_implemented")
+}
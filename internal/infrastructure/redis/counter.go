@@ -0,0 +1,29 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"trustpin_integration/internal/domain"
+)
+
+// CounterStore maps onto INCR with EXPIRE on the first increment, GET, SET
+// with PX and DEL.
+type CounterStore struct{}
+
+func (s *CounterStore) Incr(ctx context.Context, tenantID domain.TenantID, key string, ttl time.Duration) (int64, error) {
+	return 0, errors.New("not_implemented")
+}
+
+func (s *CounterStore) Get(ctx context.Context, tenantID domain.TenantID, key string) (int64, error) {
+	return 0, errors.New("not_implemented")
+}
+
+func (s *CounterStore) Set(ctx context.Context, tenantID domain.TenantID, key string, value int64, ttl time.Duration) error {
+	return errors.New("not_implemented")
+}
+
+func (s *CounterStore) Delete(ctx context.Context, tenantID domain.TenantID, key string) error {
+	return errors.New("not_implemented")
+}
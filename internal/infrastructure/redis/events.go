@@ -0,0 +1,20 @@
+package redis
+
+import (
+	"context"
+	"errors"
+
+	"trustpin_integration/internal/application"
+)
+
+// ChallengeEventRelay maps onto PUBLISH and SUBSCRIBE on one channel shared
+// by all replicas, with events encoded as JSON.
+type ChallengeEventRelay struct{}
+
+func (r *ChallengeEventRelay) Publish(ctx context.Context, e application.ChallengeEvent) error {
+	return errors.New("not_implemented")
+}
+
+func (r *ChallengeEventRelay) Subscribe(ctx context.Context, fn func(application.ChallengeEvent)) error {
+	return errors.New("not_implemented")
+}
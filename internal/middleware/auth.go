@@ -3,10 +3,14 @@ package middleware
 import (
 	"crypto/rsa"
 	"errors"
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+
+	"trustpin_integration/internal/domain"
 )
 
 type JWTValidator struct {
@@ -23,27 +27,53 @@ func NewJWTValidator(publicKeyPEM, issuer, audience string) (*JWTValidator, erro
 	return &JWTValidator{publicKey: pub, issuer: issuer, audience: audience}, nil
 }
 
-func (v *JWTValidator) Middleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		auth := r.Header.Get("Authorization")
-		if !strings.HasPrefix(auth, "Bearer ") {
-			w.WriteHeader(http.StatusUnauthorized)
-			return
-		}
-		tokenStr := strings.TrimPrefix(auth, "Bearer ")
+// RouteOption tightens what Middleware accepts on one route.
+type RouteOption func(*routePolicy)
 
-		claims := jwt.MapClaims{}
-		token, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (any, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
-				return nil, errors.New("invalid_signing_method")
-			}
-			return v.publicKey, nil
-		})
-		if err != nil || !token.Valid {
+type routePolicy struct {
+	minACR    string
+	maxMFAAge time.Duration
+	action    string
+}
+
+// MinACR requires the token's acr claim to be at least acr. Tokens without
+// the claim count as domain.ACRPassword.
+func MinACR(acr string) RouteOption {
+	return func(p *routePolicy) { p.minACR = acr }
+}
+
+// MaxMFAAge requires the token's auth_time to be no older than d.
+func MaxMFAAge(d time.Duration) RouteOption {
+	return func(p *routePolicy) { p.maxMFAAge = d }
+}
+
+// ForAction requires the token to come from a challenge for action.
+func ForAction(action string) RouteOption {
+	return func(p *routePolicy) { p.action = action }
+}
+
+// acrRank orders the acr values this service issues.
+var acrRank = map[string]int{
+	domain.ACRPassword:    1,
+	domain.ACRMultiFactor: 2,
+}
+
+func (v *JWTValidator) Middleware(next http.Handler, opts ...RouteOption) http.Handler {
+	var policy routePolicy
+	for _, opt := range opts {
+		opt(&policy)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := v.parse(r)
+		// Typed tokens, such as MFA pre-auth tokens, are not access tokens.
+		if typ, _ := claims["typ"].(string); !ok || typ != "" {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
-		if !verifyIssuer(claims, v.issuer) || !verifyAudience(claims, v.audience) {
+		if !policy.satisfiedBy(claims, time.Now()) {
+			// RFC 9470 step-up challenge: the client should obtain a token
+			// from /api/mfa/step-up and retry.
+			w.Header().Set("WWW-Authenticate", policy.challenge())
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
@@ -65,6 +95,84 @@ func (v *JWTValidator) Middleware(next http.Handler) http.Handler {
 	})
 }
 
+func (p routePolicy) satisfiedBy(claims jwt.MapClaims, now time.Time) bool {
+	if p.minACR != "" {
+		acr, _ := claims["acr"].(string)
+		if acr == "" {
+			acr = domain.ACRPassword
+		}
+		if acrRank[acr] < acrRank[p.minACR] {
+			return false
+		}
+	}
+	if p.maxMFAAge > 0 {
+		authTime, ok := claims["auth_time"].(float64)
+		if !ok || now.Sub(time.Unix(int64(authTime), 0)) > p.maxMFAAge {
+			return false
+		}
+	}
+	if p.action != "" {
+		if action, _ := claims["action"].(string); action != p.action {
+			return false
+		}
+	}
+	return true
+}
+
+func (p routePolicy) challenge() string {
+	h := `Bearer error="insufficient_user_authentication"`
+	if p.minACR != "" {
+		h += fmt.Sprintf(`, acr_values="%s"`, p.minACR)
+	}
+	if p.maxMFAAge > 0 {
+		h += fmt.Sprintf(`, max_age=%d`, int(p.maxMFAAge.Seconds()))
+	}
+	return h
+}
+
+type PreAuthClaims struct {
+	TenantID      string
+	UserID        string
+	TransactionID string
+}
+
+// PreAuth validates the request's bearer token as an MFA pre-auth token.
+func (v *JWTValidator) PreAuth(r *http.Request) (*PreAuthClaims, bool) {
+	claims, ok := v.parse(r)
+	if typ, _ := claims["typ"].(string); !ok || typ != domain.TokenTypeMFAPreAuth {
+		return nil, false
+	}
+	c := &PreAuthClaims{}
+	c.TenantID, _ = claims["tenant_id"].(string)
+	c.UserID, _ = claims["sub"].(string)
+	c.TransactionID, _ = claims["mfa_transaction_id"].(string)
+	return c, c.TransactionID != ""
+}
+
+// parse verifies the bearer token's signature, expiry, issuer and audience.
+func (v *JWTValidator) parse(r *http.Request) (jwt.MapClaims, bool) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return nil, false
+	}
+	tokenStr := strings.TrimPrefix(auth, "Bearer ")
+
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (any, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, errors.New("invalid_signing_method")
+		}
+		return v.publicKey, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, false
+	}
+	if !verifyIssuer(claims, v.issuer) || !verifyAudience(claims, v.audience) {
+		return nil, false
+	}
+	return claims, true
+}
+
 func verifyIssuer(claims jwt.MapClaims, issuer string) bool {
 	v, ok := claims["iss"].(string)
 	return ok && v == issuer
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"trustpin_integration/internal/application"
+	"trustpin_integration/internal/tracecontext"
+)
+
+// RequestMeta hands the request ID, client IP, user agent and trace context
+// to the application layer, which copies them into audit entries and
+// upstream calls. It must run inside RequestID. With trustProxy set the
+// client IP is the last address in X-Forwarded-For, as appended by the proxy
+// in front of the service, and the client's country is read from
+// countryHeader when that is set; otherwise both headers are ignored because
+// clients can forge them. A request without a valid traceparent starts a
+// trace.
+func RequestMeta(trustProxy bool, countryHeader string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rid, _ := RequestIDFromContext(r.Context())
+			meta := application.RequestMeta{
+				RequestID: rid,
+				IP:        clientIP(r, trustProxy),
+				UserAgent: r.UserAgent(),
+			}
+			tp, ok := tracecontext.Parse(r.Header.Get(tracecontext.Header))
+			if !ok {
+				tp = tracecontext.New()
+			}
+			meta.TraceParent = tp.String()
+			if trustProxy && countryHeader != "" {
+				meta.Country = strings.ToUpper(strings.TrimSpace(r.Header.Get(countryHeader)))
+			}
+			ctx := application.WithRequestMeta(r.Context(), meta)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			hops := strings.Split(xff, ",")
+			return strings.TrimSpace(hops[len(hops)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,132 @@
+package qrcode
+
+import (
+	"strings"
+	"testing"
+)
+
+// Expected symbols, "#" for a dark module, as an independent encoder
+// produces them for the same data and level.
+var vectors = []struct {
+	name  string
+	data  string
+	level Level
+	want  []string
+}{
+	{
+		name:  "version 1",
+		data:  "hello, world",
+		level: Medium,
+		want: []string{
+			"#######..#.##.#######",
+			"#.....#.##..#.#.....#",
+			"#.###.#..#..#.#.###.#",
+			"#.###.#...##..#.###.#",
+			"#.###.#.#..##.#.###.#",
+			"#.....#....#..#.....#",
+			"#######.#.#.#.#######",
+			"..........#..........",
+			"#.#.#.#..#..#...#..#.",
+			"#.##...###.#....#..##",
+			".#..####.###.#.######",
+			"####.#.######..#...#.",
+			".######.#.##....#....",
+			"........##.#..###.###",
+			"#######..#..##..#.###",
+			"#.....#....#...#...#.",
+			"#.###.#.##.###.#...#.",
+			"#.###.#..#.###.##.##.",
+			"#.###.#.#..##...#.#.#",
+			"#.....#..#.#....#..#.",
+			"#######.####...#...##",
+		},
+	},
+	{
+		name:  "version 7, four blocks",
+		data:  "trustpin://pair?code=abcdefgh&tenant=demo-tenant&expires=soon&label=a-phone-with-a-rather-long-name-for-testing!",
+		level: Medium,
+		want: []string{
+			"#######..##.#.###..#.....#...###....#.#######",
+			"#.....#..##...####.##..##.#.##..##.#..#.....#",
+			"#.###.#.#.#..#..#####..#....##.###.#..#.###.#",
+			"#.###.#.#...#.#####.#.#.##.....#...##.#.###.#",
+			"#.###.#.#.###.#....######....###..###.#.###.#",
+			"#.....#.##.#.#####..#...#......#.#....#.....#",
+			"#######.#.#.#.#.#.#.#.#.#.#.#.#.#.#.#.#######",
+			"........###.....#..##...##.###..#####........",
+			"#.#####..#...#.###.#######...##..###..#####..",
+			"#...#..#..####..#.##...##..#.###.#.###.#.####",
+			"#.#.###..########..#.#..###..#.#.######..###.",
+			"##.....#.######...#....##.###.#.#.##.#.####..",
+			"###.#.#...#..#....##.##.#..#.#.#...........#.",
+			"######..##.#..##......##.#..####...##....#..#",
+			"..###.##.##...#.##..#######..#.#.#######..##.",
+			".###.......#...#.#....###..##.#.##.########.#",
+			"...#.##.###....#.##.##..##.#...#.#.#.......##",
+			".#.##...###..###...........#..##....#....##.#",
+			"##...####..#..#..#..##.##.####...##..##..#.#.",
+			"##..##.....#.#.#..##.....####.#.#.##.##.#.#.#",
+			"..#.#######...#.#########.#..###..#.#####..#.",
+			"##.##...#.#.#...#..##...#######....##...#.#.#",
+			"#####.#.###...##..#.#.#.#......#..###.#.#..#.",
+			".#..#...#..#.##.###.#...#######.#.#.#...###..",
+			".##.#####.##..#...#.######...#.#..########.#.",
+			".##.......#####.#######.##..###.##...#...#.##",
+			"#...####...######....#....#.#..#######.##..#.",
+			"##......########.####.###..####.#.###.#.###..",
+			"#.#...#..#.##.#..##..#........##..#.....#....",
+			"##.##...##..##....#.#.#.##.####..#..#.....#.#",
+			".#..#.#...##...#####.##.#.#.#..#.##.##..####.",
+			"###..#..#..#.#.#######.#.#####..####..##.####",
+			".##...##.#.#.##....##....#...#.#.#..#####..##",
+			"###.##..#....####.######.#.#.##......#...#..#",
+			"....#.#..###....##..##...##......##.##.####..",
+			".####..#...#..#...#.#..##..###.###.#..#.###.#",
+			"#..##.##....#.......######.#...#.##.#####..##",
+			"........#.#.#......##...#..#.###.#.##...#####",
+			"#######....#......###.#.##...#.####.#.#.####.",
+			"#.....#.#.##...#..###...#..##...#.#.#...###.#",
+			"#.###.#.####..###.#.######...###..########.#.",
+			"#.###.#.#..#....#..#.#...#..#####....####.###",
+			"#.###.#.##...##....##...#.##.#.##.#.##...###.",
+			"#.....#...#....#....#..#..###..##.####.####..",
+			"#######.#...###.####...###...###...##.##...#.",
+		},
+	},
+}
+
+func TestEncodeVectors(t *testing.T) {
+	for _, v := range vectors {
+		t.Run(v.name, func(t *testing.T) {
+			c, err := Encode([]byte(v.data), v.level)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Size != len(v.want) {
+				t.Fatalf("size %d, want %d", c.Size, len(v.want))
+			}
+			for y, want := range v.want {
+				var row strings.Builder
+				for x := 0; x < c.Size; x++ {
+					if c.Dark(x, y) {
+						row.WriteByte('#')
+					} else {
+						row.WriteByte('.')
+					}
+				}
+				if got := row.String(); got != want {
+					t.Errorf("row %d:\n got %s\nwant %s", y, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	if _, err := Encode(make([]byte, 2954), Low); err != ErrTooLong {
+		t.Fatalf("err = %v, want ErrTooLong", err)
+	}
+	if _, err := Encode(make([]byte, 2953), Low); err != nil {
+		t.Fatalf("largest version 40-L payload: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+// Package tracecontext reads and writes the W3C Trace Context traceparent
+// header, version 00, so a trace started by a caller carries on through the
+// service to the providers it calls.
+package tracecontext
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// Header is the name of the header a TraceParent travels in.
+const Header = "traceparent"
+
+// TraceParent identifies a trace and the span within it that made a call.
+type TraceParent struct {
+	TraceID  string
+	ParentID string
+	Flags    string
+}
+
+// Parse reads a traceparent header value. It rejects malformed values and
+// the all-zero IDs the specification reserves as invalid.
+func Parse(v string) (TraceParent, bool) {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) != 4 || parts[0] != "00" {
+		return TraceParent{}, false
+	}
+	t := TraceParent{TraceID: parts[1], ParentID: parts[2], Flags: parts[3]}
+	if !isHex(t.TraceID, 32) || !isHex(t.ParentID, 16) || !isHex(t.Flags, 2) {
+		return TraceParent{}, false
+	}
+	if allZero(t.TraceID) || allZero(t.ParentID) {
+		return TraceParent{}, false
+	}
+	return t, true
+}
+
+// New starts a trace, sampled so the provider may record its side of it.
+func New() TraceParent {
+	return TraceParent{TraceID: randomHex(16), ParentID: randomHex(8), Flags: "01"}
+}
+
+// Child returns the traceparent for a call made from within t: the same
+// trace and flags under a new span ID.
+func (t TraceParent) Child() TraceParent {
+	return TraceParent{TraceID: t.TraceID, ParentID: randomHex(8), Flags: t.Flags}
+}
+
+func (t TraceParent) String() string {
+	return "00-" + t.TraceID + "-" + t.ParentID + "-" + t.Flags
+}
+
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func allZero(s string) bool {
+	return strings.Trim(s, "0") == ""
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
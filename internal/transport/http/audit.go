@@ -0,0 +1,110 @@
+package httptransport
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"trustpin_integration/internal/application"
+	"trustpin_integration/internal/domain"
+	"trustpin_integration/internal/middleware"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 500
+)
+
+// handleListAudit serves the tenant's audit log to admins and auditors,
+// filtered by user_id, event_type and a from/to range in RFC 3339.
+func (s *Server) handleListAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	limit, ok := queryInt(r, "limit", defaultAuditPageSize)
+	if !ok || limit < 1 || limit > maxAuditPageSize {
+		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "invalid_limit"})
+		return
+	}
+	offset, ok := queryInt(r, "offset", 0)
+	if !ok || offset < 0 {
+		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "invalid_offset"})
+		return
+	}
+	q := r.URL.Query()
+	f := application.AuditFilter{UserID: q.Get("user_id"), EventType: q.Get("event_type")}
+	if f.From, ok = queryTime(r, "from"); !ok {
+		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "invalid_from"})
+		return
+	}
+	if f.To, ok = queryTime(r, "to"); !ok {
+		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "invalid_to"})
+		return
+	}
+	tenantID, _ := middleware.TenantID(r.Context())
+	userID, _ := middleware.UserID(r.Context())
+
+	entries, total, err := s.Audit.Query(r.Context(), domain.TenantID(tenantID), userID, f, offset, limit)
+	if err != nil {
+		writeError(w, mapError(err))
+		return
+	}
+	items := make([]map[string]any, 0, len(entries))
+	for _, e := range entries {
+		items = append(items, auditJSON(e))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"entries": items,
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
+
+// handleExportAudit returns the tenant's whole audit chain with its signed
+// checkpoints, the input of the verify-audit command.
+func (s *Server) handleExportAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	tenantID, _ := middleware.TenantID(r.Context())
+	userID, _ := middleware.UserID(r.Context())
+
+	exp, err := s.Audit.Export(r.Context(), domain.TenantID(tenantID), userID)
+	if err != nil {
+		writeError(w, mapError(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, exp)
+}
+
+func auditJSON(e *domain.AuditLog) map[string]any {
+	out := map[string]any{
+		"id":         e.ID,
+		"event_type": e.EventType,
+		"payload":    json.RawMessage(e.Payload),
+		"request_id": e.RequestID,
+		"ip":         e.IP,
+		"user_agent": e.UserAgent,
+		"created_at": e.CreatedAt,
+		"seq":        e.Seq,
+		"prev_hash":  e.PrevHash,
+		"hash":       e.Hash,
+	}
+	if e.UserID != nil {
+		out["user_id"] = *e.UserID
+	}
+	return out
+}
+
+// queryTime reads an optional RFC 3339 query parameter.
+func queryTime(r *http.Request, key string) (time.Time, bool) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return time.Time{}, true
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	return t, err == nil
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"time"
 
+	"trustpin_integration/internal/application"
 	"trustpin_integration/internal/domain"
 )
 
@@ -20,6 +21,22 @@ type loginResponse struct {
 	ExpiresAt   string `json:"expires_at"`
 }
 
+// loginMFAResponse answers a login that still needs the second factor. The
+// pre-auth token is only accepted by /api/auth/mfa/complete.
+type loginMFAResponse struct {
+	MFARequired      bool                                   `json:"mfa_required"`
+	MFATransactionID string                                 `json:"mfa_transaction_id"`
+	PreAuthToken     string                                 `json:"pre_auth_token"`
+	ExpiresAt        string                                 `json:"expires_at"`
+	Challenge        *application.TrustPinChallengeResponse `json:"challenge"`
+}
+
+type completeMFARequest struct {
+	MFATransactionID string `json:"mfa_transaction_id"`
+	TOTPCode         string `json:"totp_code"`
+	RecoveryCode     string `json:"recovery_code"`
+}
+
 func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -38,10 +55,82 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	res, err := s.Auth.Login(ctx, domain.TenantID(req.TenantID), req.Username, req.Password)
 	if err != nil {
-		writeError(w, &AppError{Status: 401, Code: "invalid_credentials", Message: "invalid_credentials"})
+		writeError(w, mapError(err))
+		return
+	}
+	mfa, err := s.MFA.BeginLoginMFA(ctx, domain.TenantID(req.TenantID), res.UserID)
+	if err != nil {
+		writeError(w, mapError(err))
+		return
+	}
+	if mfa != nil {
+		preAuth, exp, err := s.Tokens.IssuePreAuth(ctx, req.TenantID, res.UserID, mfa.TransactionID)
+		if err != nil {
+			writeError(w, &AppError{Status: 500, Code: "token_error", Message: "token_issue_failed"})
+			return
+		}
+		writeJSON(w, http.StatusOK, loginMFAResponse{
+			MFARequired:      true,
+			MFATransactionID: mfa.TransactionID,
+			PreAuthToken:     preAuth,
+			ExpiresAt:        exp.UTC().Format(time.RFC3339Nano),
+			Challenge:        mfa.Challenge,
+		})
+		return
+	}
+	s.writeAccessToken(w, r, req.TenantID, res.UserID)
+}
+
+// handleCompleteMFA exchanges a pre-auth token and an approved login
+// challenge for an access token.
+func (s *Server) handleCompleteMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := s.JWT.PreAuth(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var req completeMFARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "invalid_json"})
+		return
+	}
+	if req.MFATransactionID == "" {
+		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "missing_fields"})
+		return
+	}
+	if req.MFATransactionID != claims.TransactionID {
+		writeError(w, &AppError{Status: 403, Code: "forbidden", Message: "transaction_mismatch"})
+		return
+	}
+	elevation, err := s.MFA.CompleteLoginMFA(r.Context(), domain.TenantID(claims.TenantID), claims.UserID, req.MFATransactionID, req.TOTPCode, req.RecoveryCode)
+	if err != nil {
+		writeError(w, mapError(err))
+		return
+	}
+	ttl, err := s.tokenTTL(r.Context(), claims.TenantID)
+	if err != nil {
+		writeError(w, mapError(err))
+		return
+	}
+	token, exp, err := s.Tokens.IssueElevated(r.Context(), claims.TenantID, claims.UserID, elevation, ttl)
+	if err != nil {
+		writeError(w, &AppError{Status: 500, Code: "token_error", Message: "token_issue_failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, loginResponse{AccessToken: token, ExpiresAt: exp.UTC().Format(time.RFC3339Nano)})
+}
+
+func (s *Server) writeAccessToken(w http.ResponseWriter, r *http.Request, tenantID, userID string) {
+	ttl, err := s.tokenTTL(r.Context(), tenantID)
+	if err != nil {
+		writeError(w, mapError(err))
 		return
 	}
-	token, exp, err := s.Tokens.Issue(ctx, req.TenantID, res.UserID)
+	token, exp, err := s.Tokens.Issue(r.Context(), tenantID, userID, ttl)
 	if err != nil {
 		writeError(w, &AppError{Status: 500, Code: "token_error", Message: "token_issue_failed"})
 		return
@@ -0,0 +1,146 @@
+package httptransport
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"trustpin_integration/internal/domain"
+	"trustpin_integration/internal/middleware"
+)
+
+const (
+	defaultDevicePageSize = 20
+	maxDevicePageSize     = 100
+)
+
+type renameDeviceRequest struct {
+	Name string `json:"name"`
+}
+
+func (s *Server) handleListDevices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	limit, ok := queryInt(r, "limit", defaultDevicePageSize)
+	if !ok || limit < 1 || limit > maxDevicePageSize {
+		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "invalid_limit"})
+		return
+	}
+	offset, ok := queryInt(r, "offset", 0)
+	if !ok || offset < 0 {
+		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "invalid_offset"})
+		return
+	}
+	tenantID, _ := middleware.TenantID(r.Context())
+	userID, _ := middleware.UserID(r.Context())
+
+	devices, total, err := s.MFA.ListDevices(r.Context(), domain.TenantID(tenantID), userID, offset, limit)
+	if err != nil {
+		writeError(w, mapError(err))
+		return
+	}
+	items := make([]map[string]any, 0, len(devices))
+	for _, d := range devices {
+		items = append(items, deviceJSON(d))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"devices": items,
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
+
+func (s *Server) handleDevice(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/mfa/devices/")
+	if dev, ok := strings.CutSuffix(id, "/primary"); ok {
+		s.handleDevicePrimary(w, r, dev)
+		return
+	}
+	if id == "" || strings.Contains(id, "/") {
+		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "missing_id"})
+		return
+	}
+	tenantID, _ := middleware.TenantID(r.Context())
+	userID, _ := middleware.UserID(r.Context())
+
+	switch r.Method {
+	case http.MethodPatch:
+		var req renameDeviceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "invalid_json"})
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "missing_fields"})
+			return
+		}
+		d, err := s.MFA.RenameDevice(r.Context(), domain.TenantID(tenantID), userID, id, req.Name)
+		if err != nil {
+			writeError(w, mapError(err))
+			return
+		}
+		writeJSON(w, http.StatusOK, deviceJSON(d))
+	case http.MethodDelete:
+		if err := s.MFA.RevokeDevice(r.Context(), domain.TenantID(tenantID), userID, id); err != nil {
+			writeError(w, mapError(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleDevicePrimary makes the device the user's primary device with PUT and
+// stops it being one with DELETE.
+func (s *Server) handleDevicePrimary(w http.ResponseWriter, r *http.Request, id string) {
+	if id == "" || strings.Contains(id, "/") {
+		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "missing_id"})
+		return
+	}
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	tenantID, _ := middleware.TenantID(r.Context())
+	userID, _ := middleware.UserID(r.Context())
+
+	d, err := s.MFA.SetPrimaryDevice(r.Context(), domain.TenantID(tenantID), userID, id, r.Method == http.MethodPut)
+	if err != nil {
+		writeError(w, mapError(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, deviceJSON(d))
+}
+
+func deviceJSON(d *domain.MFADevice) map[string]any {
+	return map[string]any{
+		"device_id":          d.ID,
+		"type":               d.Type,
+		"name":               d.DeviceName,
+		"status":             d.State,
+		"primary":            d.Primary,
+		"trustpin_device_id": d.TrustPinDeviceID,
+		"created_at":         d.CreatedAt,
+		"updated_at":         d.UpdatedAt,
+	}
+}
+
+// queryInt reads an integer query parameter, falling back to def when the
+// parameter is absent. ok is false when the value is present but malformed.
+func queryInt(r *http.Request, name string, def int) (int, bool) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
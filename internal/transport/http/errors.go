@@ -2,7 +2,12 @@ package httptransport
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
+
+	"trustpin_integration/internal/application"
 )
 
 type AppError struct {
@@ -10,6 +15,8 @@ type AppError struct {
 	Code    string
 	Message string
 	Details any
+	// RetryAfter is sent as the Retry-After header when set.
+	RetryAfter time.Duration
 }
 
 func (e *AppError) Error() string {
@@ -18,6 +25,9 @@ func (e *AppError) Error() string {
 
 func writeError(w http.ResponseWriter, err *AppError) {
 	w.Header().Set("Content-Type", "application/json")
+	if err.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int((err.RetryAfter+time.Second-1)/time.Second)))
+	}
 	w.WriteHeader(err.Status)
 	_ = json.NewEncoder(w).Encode(map[string]any{
 		"code":    err.Code,
@@ -31,3 +41,79 @@ func writeJSON(w http.ResponseWriter, status int, payload any) {
 	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(payload)
 }
+
+// errorStatuses maps application error kinds to HTTP responses. When code is
+// set it replaces the application code in the response's "code" field and
+// the application code moves to "message"; otherwise both carry it.
+var errorStatuses = []struct {
+	kind   error
+	status int
+	code   string
+}{
+	{application.ErrInvalidInput, http.StatusBadRequest, "bad_request"},
+	{application.ErrUnauthenticated, http.StatusUnauthorized, ""},
+	{application.ErrForbidden, http.StatusForbidden, ""},
+	{application.ErrNotFound, http.StatusNotFound, ""},
+	{application.ErrConflict, http.StatusConflict, ""},
+	{application.ErrInvalidState, http.StatusConflict, ""},
+	{application.ErrExpired, http.StatusGone, ""},
+	{application.ErrUpstream, http.StatusBadGateway, "upstream_error"},
+	{application.ErrInvalidResponse, http.StatusBadGateway, ""},
+	{application.ErrTimeout, http.StatusGatewayTimeout, "upstream_timeout"},
+	{application.ErrRateLimited, http.StatusTooManyRequests, ""},
+}
+
+// upstreamErrors maps provider response statuses to HTTP responses.
+// Statuses not listed become 502 <provider>_error.
+var upstreamErrors = map[int]AppError{
+	http.StatusBadRequest:         {Status: 400, Code: "bad_request", Message: "invalid_payload"},
+	http.StatusNotFound:           {Status: 404, Code: "not_found", Message: "not_found"},
+	http.StatusConflict:           {Status: 409, Code: "invalid_state", Message: "invalid_state"},
+	http.StatusGone:               {Status: 410, Code: "expired", Message: "expired"},
+	http.StatusPreconditionFailed: {Status: 422, Code: "invalid_signature", Message: "signature_mismatch"},
+	http.StatusTooManyRequests:    {Status: 429, Code: "rate_limited", Message: "rate_limited"},
+	http.StatusServiceUnavailable: {Status: 503, Code: "push_failed", Message: "push_failed"},
+}
+
+func mapError(err error) *AppError {
+	var up *application.UpstreamError
+	isUpstream := errors.As(err, &up)
+	if isUpstream && up.Status != 0 {
+		mapped, ok := upstreamErrors[up.Status]
+		if !ok {
+			mapped = AppError{Status: 502, Code: upstreamCode(up), Message: "upstream_error"}
+		}
+		mapped.Details = string(up.Body)
+		return &mapped
+	}
+
+	kind, code := application.Classify(err)
+	for _, row := range errorStatuses {
+		if row.kind != kind {
+			continue
+		}
+		mapped := &AppError{Status: row.status, Code: row.code, Message: code}
+		if row.code == "" {
+			mapped.Code = code
+		}
+		if isUpstream && kind == application.ErrUpstream {
+			mapped.Code = upstreamCode(up)
+		}
+		var e *application.Error
+		if errors.As(err, &e) && kind == application.ErrRateLimited {
+			mapped.Details = map[string]any{"reason": e.Detail}
+			mapped.RetryAfter = e.RetryAfter
+		}
+		return mapped
+	}
+	return &AppError{Status: 500, Code: "server_error", Message: "internal_error"}
+}
+
+// upstreamCode names the provider that failed, as in trustpin_error, or
+// gives upstream_error when the error does not say.
+func upstreamCode(up *application.UpstreamError) string {
+	if up.Provider == "" {
+		return "upstream_error"
+	}
+	return up.Provider + "_error"
+}
@@ -0,0 +1,124 @@
+package httptransport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"trustpin_integration/internal/application"
+	"trustpin_integration/internal/domain"
+	"trustpin_integration/internal/middleware"
+)
+
+const (
+	// maxChallengeWait caps the ?wait= long-poll duration.
+	maxChallengeWait = time.Minute
+	// sseKeepAlive is how often an idle event stream sends a comment so
+	// proxies do not close it.
+	sseKeepAlive = 15 * time.Second
+)
+
+// longLived reports whether r holds its connection open on purpose: the
+// event stream of a challenge or a ?wait= long poll on one. Those are
+// bounded by their own limits rather than the request timeout.
+func longLived(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	id, ok := strings.CutPrefix(r.URL.Path, "/api/mfa/challenge/")
+	if !ok || id == "" {
+		return false
+	}
+	if events, ok := strings.CutSuffix(id, "/events"); ok {
+		return events != "" && !strings.Contains(events, "/")
+	}
+	return !strings.Contains(id, "/") && r.URL.Query().Get("wait") != ""
+}
+
+// waitChallenge serves the ?wait= long-poll: it holds the request until the
+// challenge leaves its open state or wait elapses.
+func (s *Server) waitChallenge(r *http.Request, tenantID domain.TenantID, userID, id, wait string) (*domain.MFAChallenge, error) {
+	d, err := time.ParseDuration(wait)
+	if err != nil || d < 0 {
+		return nil, application.InvalidInput("invalid_wait")
+	}
+	if d > maxChallengeWait {
+		d = maxChallengeWait
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), d)
+	defer cancel()
+	return s.MFA.WaitChallenge(ctx, tenantID, userID, id)
+}
+
+// handleChallengeEvents streams a challenge's state as Server-Sent Events:
+// one "state" event with the current state, another on every change, and
+// the stream ends once the challenge is settled.
+func (s *Server) handleChallengeEvents(w http.ResponseWriter, r *http.Request, id string) {
+	if id == "" {
+		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "missing_id"})
+		return
+	}
+	tenantID, _ := middleware.TenantID(r.Context())
+	userID, _ := middleware.UserID(r.Context())
+	ctx := r.Context()
+
+	// Subscribe before the first read so a change in between is not missed.
+	events, unsubscribe := s.MFA.SubscribeChallenge(domain.TenantID(tenantID), id)
+	defer unsubscribe()
+
+	c, err := s.MFA.ChallengeFor(ctx, domain.TenantID(tenantID), userID, id)
+	if err != nil {
+		writeError(w, mapError(err))
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	sent := ""
+	for {
+		if c.State != sent {
+			if err := writeSSE(w, "state", challengeJSON(c)); err != nil {
+				return
+			}
+			sent = c.State
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+		if !c.Open() {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			continue
+		case <-events:
+		}
+		next, err := s.MFA.ChallengeFor(ctx, domain.TenantID(tenantID), userID, id)
+		if err != nil {
+			return
+		}
+		c = next
+	}
+}
+
+func writeSSE(w http.ResponseWriter, event string, data any) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+	return err
+}
@@ -0,0 +1,89 @@
+package httptransport
+
+import (
+	"net/http"
+	"strings"
+
+	"trustpin_integration/internal/application"
+	"trustpin_integration/internal/domain"
+	"trustpin_integration/internal/middleware"
+)
+
+// handleChallengeHistory returns the timeline of one of the caller's
+// challenges.
+func (s *Server) handleChallengeHistory(w http.ResponseWriter, r *http.Request, id string) {
+	if id == "" || strings.Contains(id, "/") {
+		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "missing_id"})
+		return
+	}
+	tenantID, _ := middleware.TenantID(r.Context())
+	userID, _ := middleware.UserID(r.Context())
+
+	t, err := s.MFA.ChallengeHistory(r.Context(), domain.TenantID(tenantID), userID, id)
+	if err != nil {
+		writeError(w, mapError(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, timelineJSON(t))
+}
+
+// handleAdminChallengeHistory returns the timeline of any challenge in the
+// tenant, for admins and auditors looking into a user's report.
+func (s *Server) handleAdminChallengeHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/admin/challenges/"), "/history")
+	if !ok || id == "" || strings.Contains(id, "/") {
+		writeError(w, &AppError{Status: 404, Code: "not_found", Message: "not_found"})
+		return
+	}
+	tenantID, _ := middleware.TenantID(r.Context())
+	userID, _ := middleware.UserID(r.Context())
+
+	t, err := s.MFA.AdminChallengeHistory(r.Context(), domain.TenantID(tenantID), userID, id)
+	if err != nil {
+		writeError(w, mapError(err))
+		return
+	}
+	out := timelineJSON(t)
+	out["user_id"] = t.Challenge.UserID
+	writeJSON(w, http.StatusOK, out)
+}
+
+func timelineJSON(t *application.ChallengeTimeline) map[string]any {
+	c := t.Challenge
+	history := make([]map[string]any, 0, len(t.Transitions))
+	from := ""
+	for _, tr := range t.Transitions {
+		history = append(history, map[string]any{
+			"from":           from,
+			"to":             tr.State,
+			"actor":          tr.Actor,
+			"correlation_id": tr.CorrelationID,
+			"at":             tr.At,
+		})
+		from = tr.State
+	}
+	out := map[string]any{
+		"challenge_id": c.ID,
+		"device_id":    c.DeviceID,
+		"action":       c.Action,
+		"status":       c.State,
+		"issued_at":    c.IssuedAt,
+		"expires_at":   c.ExpiresAt,
+		"history":      history,
+	}
+	if c.TrustPinChallengeID != "" {
+		out["trustpin_challenge_id"] = c.TrustPinChallengeID
+	}
+	if len(t.Members) > 0 {
+		members := make([]map[string]any, len(t.Members))
+		for i, m := range t.Members {
+			members[i] = timelineJSON(m)
+		}
+		out["members"] = members
+	}
+	return out
+}
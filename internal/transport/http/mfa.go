@@ -2,12 +2,9 @@ package httptransport
 
 import (
 	"encoding/json"
-	"errors"
 	"net/http"
 	"strings"
-	"time"
 
-	"trustpin_integration/internal/adapters/trustpin"
 	"trustpin_integration/internal/application"
 	"trustpin_integration/internal/domain"
 	"trustpin_integration/internal/middleware"
@@ -42,9 +39,14 @@ func (s *Server) handleIdempotency(w http.ResponseWriter, r *http.Request, tenan
 	writeJSON(w, http.StatusOK, payload)
 
 	if key != "" && s.MFA.IdemStore != nil {
+		pol, err := s.Policy.Effective(r.Context(), domain.TenantID(tenantID))
+		if err != nil {
+			s.Log.Error("idempotency_policy", "tenant_id", tenantID, "error", err)
+			return
+		}
 		resp := cachedResponse{Status: http.StatusOK, Body: body}
 		if b, err := json.Marshal(resp); err == nil {
-			_ = s.MFA.IdemStore.Set(r.Context(), domain.TenantID(tenantID), key, b, 5*time.Minute)
+			_ = s.MFA.IdemStore.Set(r.Context(), domain.TenantID(tenantID), key, b, pol.IdempotencyTTL)
 		}
 	}
 }
@@ -61,9 +63,9 @@ type activateRequest struct {
 }
 
 type challengeRequest struct {
-	DeviceID  string         `json:"device_id"`
-	Action    string         `json:"action"`
-	Context   map[string]any `json:"context"`
+	DeviceID string         `json:"device_id"`
+	Action   string         `json:"action"`
+	Context  map[string]any `json:"context"`
 }
 
 type approveRequest struct {
@@ -147,7 +149,8 @@ func (s *Server) handleCreateChallenge(w http.ResponseWriter, r *http.Request) {
 		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "invalid_json"})
 		return
 	}
-	if req.DeviceID == "" || req.Action == "" {
+	// Without device_id the challenge fans out to the user's devices.
+	if req.Action == "" {
 		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "missing_fields"})
 		return
 	}
@@ -179,7 +182,8 @@ func (s *Server) handleApprove(w http.ResponseWriter, r *http.Request) {
 		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "invalid_json"})
 		return
 	}
-	if req.ChallengeID == "" || req.DeviceID == "" || req.Signature == "" || req.Payload == nil {
+	// A TOTP challenge is answered with the code alone.
+	if req.ChallengeID == "" || (req.TOTPCode == "" && (req.DeviceID == "" || req.Signature == "" || req.Payload == nil)) {
 		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "missing_fields"})
 		return
 	}
@@ -203,31 +207,86 @@ func (s *Server) handleApprove(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+type denyRequest struct {
+	ChallengeID string `json:"challenge_id"`
+}
+
+func (s *Server) handleDeny(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req denyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "invalid_json"})
+		return
+	}
+	if req.ChallengeID == "" {
+		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "missing_fields"})
+		return
+	}
+	tenantID, _ := middleware.TenantID(r.Context())
+	userID, _ := middleware.UserID(r.Context())
+
+	res, err := s.MFA.Deny(r.Context(), domain.TenantID(tenantID), userID, req.ChallengeID)
+	if err != nil {
+		writeError(w, mapError(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
 func (s *Server) handleGetChallenge(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
 	id := strings.TrimPrefix(r.URL.Path, "/api/mfa/challenge/")
+	if events, ok := strings.CutSuffix(id, "/events"); ok {
+		s.handleChallengeEvents(w, r, events)
+		return
+	}
+	if history, ok := strings.CutSuffix(id, "/history"); ok {
+		s.handleChallengeHistory(w, r, history)
+		return
+	}
 	if id == "" {
 		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "missing_id"})
 		return
 	}
 	tenantID, _ := middleware.TenantID(r.Context())
-	c, err := s.MFA.Challenges.GetByID(r.Context(), domain.TenantID(tenantID), id)
+	userID, _ := middleware.UserID(r.Context())
+	var (
+		c   *domain.MFAChallenge
+		err error
+	)
+	if wait := r.URL.Query().Get("wait"); wait != "" {
+		c, err = s.waitChallenge(r, domain.TenantID(tenantID), userID, id, wait)
+	} else {
+		c, err = s.MFA.ChallengeFor(r.Context(), domain.TenantID(tenantID), userID, id)
+	}
 	if err != nil {
-		writeError(w, &AppError{Status: 500, Code: "server_error", Message: "failed"})
+		writeError(w, mapError(err))
 		return
 	}
-	if c == nil {
-		writeError(w, &AppError{Status: 404, Code: "not_found", Message: "not_found"})
-		return
+	out := challengeJSON(c)
+	if c.Quorum > 0 {
+		t, err := s.MFA.QuorumStatus(r.Context(), c)
+		if err != nil {
+			writeError(w, &AppError{Status: 500, Code: "server_error", Message: "failed"})
+			return
+		}
+		out["quorum"] = quorumJSON(t)
 	}
-	writeJSON(w, http.StatusOK, map[string]any{
+	writeJSON(w, http.StatusOK, out)
+}
+
+func challengeJSON(c *domain.MFAChallenge) map[string]any {
+	return map[string]any{
 		"challenge_id": c.ID,
 		"status":       c.State,
 		"updated_at":   c.UpdatedAt,
-	})
+	}
 }
 
 func (s *Server) handleGetStatus(w http.ResponseWriter, r *http.Request) {
@@ -241,7 +300,7 @@ func (s *Server) handleGetStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	tenantID, _ := middleware.TenantID(r.Context())
-	d, err := s.MFA.Devices.GetByID(r.Context(), domain.TenantID(tenantID), id)
+	d, err := s.MFA.FindDevice(r.Context(), domain.TenantID(tenantID), id)
 	if err != nil {
 		writeError(w, &AppError{Status: 500, Code: "server_error", Message: "failed"})
 		return
@@ -255,37 +314,3 @@ func (s *Server) handleGetStatus(w http.ResponseWriter, r *http.Request) {
 		"status":    d.State,
 	})
 }
-
-func mapError(err error) *AppError {
-	var tpErr *trustpin.Error
-	if errors.As(err, &tpErr) {
-		switch tpErr.Status {
-		case 400:
-			return &AppError{Status: 400, Code: "bad_request", Message: "invalid_payload", Details: string(tpErr.Body)}
-		case 404:
-			return &AppError{Status: 404, Code: "not_found", Message: "not_found", Details: string(tpErr.Body)}
-		case 409:
-			return &AppError{Status: 409, Code: "invalid_state", Message: "invalid_state", Details: string(tpErr.Body)}
-		case 410:
-			return &AppError{Status: 410, Code: "expired", Message: "expired", Details: string(tpErr.Body)}
-		case 412:
-			return &AppError{Status: 422, Code: "invalid_signature", Message: "signature_mismatch", Details: string(tpErr.Body)}
-		case 429:
-			return &AppError{Status: 429, Code: "rate_limited", Message: "rate_limited", Details: string(tpErr.Body)}
-		case 503:
-			return &AppError{Status: 503, Code: "push_failed", Message: "push_failed", Details: string(tpErr.Body)}
-		default:
-			return &AppError{Status: 502, Code: "trustpin_error", Message: "upstream_error", Details: string(tpErr.Body)}
-		}
-	}
-	if err.Error() == "nonce_reuse" {
-		return &AppError{Status: 409, Code: "nonce_reuse", Message: "nonce_reuse"}
-	}
-	if err.Error() == "invalid_state" {
-		return &AppError{Status: 409, Code: "invalid_state", Message: "invalid_state"}
-	}
-	if err.Error() == "missing_nonce" {
-		return &AppError{Status: 400, Code: "bad_request", Message: "missing_nonce"}
-	}
-	return &AppError{Status: 500, Code: "server_error", Message: "internal_error"}
-}
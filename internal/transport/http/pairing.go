@@ -0,0 +1,67 @@
+package httptransport
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"trustpin_integration/internal/domain"
+	"trustpin_integration/internal/middleware"
+	"trustpin_integration/internal/qrcode"
+)
+
+// QR codes are drawn with 8 pixels per module and the standard 4 module
+// quiet zone.
+const (
+	qrScale  = 8
+	qrBorder = 4
+)
+
+// handleEnrollmentQR renders the pairing deep link of an enrollment as a QR
+// code for the Trustpin app to scan, as PNG or, with ?format=svg, SVG.
+func (s *Server) handleEnrollmentQR(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/mfa/enroll/"), "/qr")
+	if !ok || id == "" || strings.Contains(id, "/") {
+		writeError(w, &AppError{Status: 404, Code: "not_found", Message: "not_found"})
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "png" && format != "svg" {
+		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "invalid_format"})
+		return
+	}
+	tenantID, _ := middleware.TenantID(r.Context())
+	userID, _ := middleware.UserID(r.Context())
+
+	link, expires, err := s.MFA.PairingLink(r.Context(), domain.TenantID(tenantID), userID, id)
+	if err != nil {
+		writeError(w, mapError(err))
+		return
+	}
+	code, err := qrcode.Encode([]byte(link), qrcode.Medium)
+	if err != nil {
+		writeError(w, mapError(err))
+		return
+	}
+
+	var body []byte
+	if format == "svg" {
+		w.Header().Set("Content-Type", "image/svg+xml")
+		body = code.SVG(qrScale, qrBorder)
+	} else {
+		w.Header().Set("Content-Type", "image/png")
+		if body, err = code.PNG(qrScale, qrBorder); err != nil {
+			writeError(w, mapError(err))
+			return
+		}
+	}
+	// The image carries the pairing code: keep it out of every cache.
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Pairing-Expires-At", expires.UTC().Format(time.RFC3339))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+}
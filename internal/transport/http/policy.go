@@ -0,0 +1,160 @@
+package httptransport
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"trustpin_integration/internal/domain"
+	"trustpin_integration/internal/middleware"
+)
+
+// policyBody is a tenant policy on the wire. Durations are
+// time.ParseDuration strings; zero and empty fields mean the default.
+type policyBody struct {
+	MFAActions            []string `json:"mfa_actions"`
+	AllowedFactors        []string `json:"allowed_factors"`
+	MaxDevicesPerUser     int      `json:"max_devices_per_user"`
+	ChallengeTTL          string   `json:"challenge_ttl"`
+	NonceTTL              string   `json:"nonce_ttl"`
+	TokenTTL              string   `json:"token_ttl"`
+	IdempotencyTTL        string   `json:"idempotency_ttl"`
+	MaxConsecutiveDenials int      `json:"max_consecutive_denials"`
+	LockoutBase           string   `json:"lockout_base"`
+	LockoutMax            string   `json:"lockout_max"`
+	Providers             []string `json:"providers"`
+}
+
+// handleAdminPolicy reads and replaces the tenant's MFA policy. GET returns
+// the stored policy and the policy in force; PUT replaces the stored one.
+func (s *Server) handleAdminPolicy(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantID(r.Context())
+	userID, _ := middleware.UserID(r.Context())
+
+	switch r.Method {
+	case http.MethodGet:
+		stored, eff, err := s.Policy.Get(r.Context(), domain.TenantID(tenantID), userID)
+		if err != nil {
+			writeError(w, mapError(err))
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"policy": policyJSON(stored), "effective": policyJSON(eff)})
+	case http.MethodPut:
+		var req policyBody
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "invalid_json"})
+			return
+		}
+		pol, ok := req.policy()
+		if !ok {
+			writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "invalid_duration"})
+			return
+		}
+		eff, err := s.Policy.Put(r.Context(), domain.TenantID(tenantID), userID, pol)
+		if err != nil {
+			writeError(w, mapError(err))
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"policy": policyJSON(pol), "effective": policyJSON(eff)})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleGetPolicy tells the caller what their tenant's policy asks of them:
+// the actions that need MFA, the factors they may enroll and how long a
+// challenge stays open.
+func (s *Server) handleGetPolicy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	tenantID, _ := middleware.TenantID(r.Context())
+	pol, err := s.Policy.Effective(r.Context(), domain.TenantID(tenantID))
+	if err != nil {
+		writeError(w, mapError(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"mfa_actions":          nonNil(pol.MFAActions),
+		"allowed_factors":      nonNil(pol.AllowedFactors),
+		"max_devices_per_user": pol.MaxDevicesPerUser,
+		"challenge_ttl":        pol.ChallengeTTL.String(),
+	})
+}
+
+// tokenTTL is the lifetime of access tokens issued in the tenant.
+func (s *Server) tokenTTL(ctx context.Context, tenantID string) (time.Duration, error) {
+	pol, err := s.Policy.Effective(ctx, domain.TenantID(tenantID))
+	if err != nil {
+		return 0, err
+	}
+	return pol.TokenTTL, nil
+}
+
+func (b policyBody) policy() (*domain.TenantPolicy, bool) {
+	p := &domain.TenantPolicy{
+		MFAActions:            b.MFAActions,
+		AllowedFactors:        b.AllowedFactors,
+		MaxDevicesPerUser:     b.MaxDevicesPerUser,
+		MaxConsecutiveDenials: b.MaxConsecutiveDenials,
+		Providers:             b.Providers,
+	}
+	for _, f := range []struct {
+		in  string
+		out *time.Duration
+	}{
+		{b.ChallengeTTL, &p.ChallengeTTL},
+		{b.NonceTTL, &p.NonceTTL},
+		{b.TokenTTL, &p.TokenTTL},
+		{b.IdempotencyTTL, &p.IdempotencyTTL},
+		{b.LockoutBase, &p.LockoutBase},
+		{b.LockoutMax, &p.LockoutMax},
+	} {
+		if f.in == "" {
+			continue
+		}
+		d, err := time.ParseDuration(f.in)
+		if err != nil {
+			return nil, false
+		}
+		*f.out = d
+	}
+	return p, true
+}
+
+func policyJSON(p *domain.TenantPolicy) map[string]any {
+	out := map[string]any{
+		"mfa_actions":             nonNil(p.MFAActions),
+		"allowed_factors":         nonNil(p.AllowedFactors),
+		"max_devices_per_user":    p.MaxDevicesPerUser,
+		"challenge_ttl":           durationJSON(p.ChallengeTTL),
+		"nonce_ttl":               durationJSON(p.NonceTTL),
+		"token_ttl":               durationJSON(p.TokenTTL),
+		"idempotency_ttl":         durationJSON(p.IdempotencyTTL),
+		"max_consecutive_denials": p.MaxConsecutiveDenials,
+		"lockout_base":            durationJSON(p.LockoutBase),
+		"lockout_max":             durationJSON(p.LockoutMax),
+		"providers":               nonNil(p.Providers),
+	}
+	if !p.UpdatedAt.IsZero() {
+		out["updated_at"] = p.UpdatedAt
+	}
+	return out
+}
+
+// durationJSON renders an unset duration as "" rather than "0s".
+func durationJSON(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,64 @@
+package httptransport
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"trustpin_integration/internal/application"
+	"trustpin_integration/internal/domain"
+	"trustpin_integration/internal/middleware"
+)
+
+type quorumChallengeRequest struct {
+	Action    string         `json:"action"`
+	Approvers []string       `json:"approvers"`
+	Required  int            `json:"required"`
+	Context   map[string]any `json:"context"`
+}
+
+// handleCreateQuorumChallenge asks other users to approve an action for the
+// caller.
+func (s *Server) handleCreateQuorumChallenge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req quorumChallengeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "invalid_json"})
+		return
+	}
+	if req.Action == "" || len(req.Approvers) == 0 || req.Required == 0 {
+		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "missing_fields"})
+		return
+	}
+	tenantID, _ := middleware.TenantID(r.Context())
+	userID, _ := middleware.UserID(r.Context())
+
+	s.handleIdempotency(w, r, tenantID, func() (any, *AppError) {
+		res, err := s.MFA.CreateQuorumChallenge(r.Context(), domain.TenantID(tenantID), userID, application.QuorumChallengeRequest{
+			Action:    req.Action,
+			Approvers: req.Approvers,
+			Required:  req.Required,
+			Context:   req.Context,
+		})
+		if err != nil {
+			return nil, mapError(err)
+		}
+		return res, nil
+	})
+}
+
+func quorumJSON(t *application.QuorumTally) map[string]any {
+	approvers := make([]map[string]any, 0, len(t.Approvers))
+	for _, v := range t.Approvers {
+		approvers = append(approvers, map[string]any{"user_id": v.UserID, "status": v.State})
+	}
+	return map[string]any{
+		"required":  t.Required,
+		"approved":  t.Approved,
+		"denied":    t.Denied,
+		"pending":   t.Pending,
+		"approvers": approvers,
+	}
+}
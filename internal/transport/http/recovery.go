@@ -0,0 +1,59 @@
+package httptransport
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"trustpin_integration/internal/domain"
+	"trustpin_integration/internal/middleware"
+)
+
+type redeemRecoveryCodeRequest struct {
+	ChallengeID string `json:"challenge_id"`
+	Code        string `json:"code"`
+}
+
+// handleRecoveryCodes issues a new set of recovery codes. It deliberately
+// skips the idempotency cache, which would keep the plain codes around.
+func (s *Server) handleRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	tenantID, _ := middleware.TenantID(r.Context())
+	userID, _ := middleware.UserID(r.Context())
+
+	res, err := s.MFA.GenerateRecoveryCodes(r.Context(), domain.TenantID(tenantID), userID)
+	if err != nil {
+		writeError(w, mapError(err))
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) handleRedeemRecoveryCode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req redeemRecoveryCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "invalid_json"})
+		return
+	}
+	if req.ChallengeID == "" || req.Code == "" {
+		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "missing_fields"})
+		return
+	}
+	tenantID, _ := middleware.TenantID(r.Context())
+	userID, _ := middleware.UserID(r.Context())
+
+	s.handleIdempotency(w, r, tenantID, func() (any, *AppError) {
+		res, err := s.MFA.RedeemRecoveryCode(r.Context(), domain.TenantID(tenantID), userID, req.ChallengeID, req.Code)
+		if err != nil {
+			return nil, mapError(err)
+		}
+		return res, nil
+	})
+}
@@ -3,20 +3,43 @@ package httptransport
 import (
 	"log/slog"
 	"net/http"
+	"slices"
 	"time"
 
 	"trustpin_integration/internal/application"
+	"trustpin_integration/internal/domain"
 	"trustpin_integration/internal/middleware"
 )
 
 type Server struct {
-	Auth *application.AuthService
-	MFA  *application.MFAService
-	JWT  *middleware.JWTValidator
-	Log  *slog.Logger
+	Auth   *application.AuthService
+	MFA    *application.MFAService
+	Audit  *application.AuditService
+	Policy *application.PolicyService
+	JWT    *middleware.JWTValidator
+	Log    *slog.Logger
 	Tokens TokenIssuer
+	// TrustProxy takes client IPs from X-Forwarded-For; set it only behind
+	// a proxy that appends to the header.
+	TrustProxy bool
+	// CountryHeader names the header a trusted proxy puts the client's
+	// country in, such as CF-IPCountry. It is read only with TrustProxy.
+	CountryHeader string
+	// WebhookSecret verifies the signature of Trustpin webhooks; without it
+	// they are rejected.
+	WebhookSecret string
+	// RequestTimeout bounds each request, including the Trustpin calls made
+	// for it; zero leaves requests unbounded.
+	RequestTimeout time.Duration
+	// StepUpMaxAge is how recent the MFA behind an elevated token must be
+	// for the sensitive routes; zero means defaultStepUpMaxAge.
+	StepUpMaxAge time.Duration
 }
 
+// defaultStepUpMaxAge matches the window in which an approved challenge can
+// be exchanged for an elevated token.
+const defaultStepUpMaxAge = 5 * time.Minute
+
 func (s *Server) Routes() http.Handler {
 	mux := http.NewServeMux()
 
@@ -24,14 +47,33 @@ func (s *Server) Routes() http.Handler {
 	mux.HandleFunc("/swagger/openapi.yaml", s.handleOpenAPI)
 	mux.HandleFunc("/swagger/", s.handleSwaggerUI)
 	mux.HandleFunc("/api/auth/login", s.handleLogin)
+	mux.HandleFunc("/api/auth/mfa/complete", s.handleCompleteMFA)
+	mux.HandleFunc("/api/webhooks/trustpin", s.handleTrustPinWebhook)
 
 	secured := http.NewServeMux()
 	secured.HandleFunc("/api/mfa/enroll", s.handleEnroll)
+	secured.HandleFunc("/api/mfa/enroll/", s.handleEnrollmentQR)
 	secured.HandleFunc("/api/mfa/activate", s.handleActivate)
 	secured.HandleFunc("/api/mfa/challenge", s.handleCreateChallenge)
+	secured.HandleFunc("/api/mfa/quorum-challenge", s.handleCreateQuorumChallenge)
 	secured.HandleFunc("/api/mfa/approve", s.handleApprove)
+	secured.HandleFunc("/api/mfa/deny", s.handleDeny)
+	secured.HandleFunc("/api/mfa/step-up", s.handleStepUp)
 	secured.HandleFunc("/api/mfa/challenge/", s.handleGetChallenge)
 	secured.HandleFunc("/api/mfa/status/", s.handleGetStatus)
+	secured.HandleFunc("/api/mfa/totp/enroll", s.handleEnrollTOTP)
+	secured.HandleFunc("/api/mfa/totp/activate", s.handleActivateTOTP)
+	secured.Handle("/api/mfa/recovery-codes", s.requireStepUp(s.handleRecoveryCodes, http.MethodPost))
+	secured.HandleFunc("/api/mfa/recovery-codes/redeem", s.handleRedeemRecoveryCode)
+	secured.HandleFunc("/api/mfa/devices", s.handleListDevices)
+	secured.Handle("/api/mfa/devices/", s.requireStepUp(s.handleDevice, http.MethodDelete))
+	secured.HandleFunc("/api/mfa/policy", s.handleGetPolicy)
+
+	admin := http.NewServeMux()
+	admin.HandleFunc("/api/admin/audit", s.handleListAudit)
+	admin.Handle("/api/admin/audit/export", s.requireStepUp(s.handleExportAudit, http.MethodGet))
+	admin.Handle("/api/admin/policy", s.requireStepUp(s.handleAdminPolicy, http.MethodPut))
+	admin.HandleFunc("/api/admin/challenges/", s.handleAdminChallengeHistory)
 
 	var handler http.Handler = mux
 	securedHandler := http.Handler(secured)
@@ -39,13 +81,34 @@ func (s *Server) Routes() http.Handler {
 	securedHandler = s.JWT.Middleware(securedHandler)
 
 	mux.Handle("/api/mfa/", securedHandler)
+	mux.Handle("/api/admin/", s.JWT.Middleware(middleware.EnforceTenant(admin)))
 
+	handler = middleware.Deadline(s.RequestTimeout, longLived)(handler)
+	handler = middleware.RequestMeta(s.TrustProxy, s.CountryHeader)(handler)
 	handler = middleware.RequestID(handler)
 	handler = middleware.Logging(s.Log)(handler)
 
 	return handler
 }
 
+// requireStepUp makes requests using one of methods present an elevated
+// token from recent MFA; without one they get the RFC 9470 step-up
+// challenge. Other methods pass as they are.
+func (s *Server) requireStepUp(h http.HandlerFunc, methods ...string) http.Handler {
+	maxAge := s.StepUpMaxAge
+	if maxAge <= 0 {
+		maxAge = defaultStepUpMaxAge
+	}
+	elevated := s.JWT.Middleware(h, middleware.MinACR(domain.ACRMultiFactor), middleware.MaxMFAAge(maxAge))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slices.Contains(methods, r.Method) {
+			elevated.ServeHTTP(w, r)
+			return
+		}
+		h(w, r)
+	})
+}
+
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]any{"status": "ok", "time": time.Now().UTC()})
 }
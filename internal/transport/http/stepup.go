@@ -0,0 +1,66 @@
+package httptransport
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"trustpin_integration/internal/domain"
+	"trustpin_integration/internal/middleware"
+)
+
+type stepUpRequest struct {
+	ChallengeID string `json:"challenge_id"`
+}
+
+type stepUpResponse struct {
+	AccessToken string   `json:"access_token"`
+	ExpiresAt   string   `json:"expires_at"`
+	ACR         string   `json:"acr"`
+	AMR         []string `json:"amr"`
+	AuthTime    string   `json:"auth_time"`
+	Action      string   `json:"action,omitempty"`
+}
+
+// handleStepUp exchanges an approved challenge for an elevated token.
+func (s *Server) handleStepUp(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req stepUpRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "invalid_json"})
+		return
+	}
+	if req.ChallengeID == "" {
+		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "missing_fields"})
+		return
+	}
+	tenantID, _ := middleware.TenantID(r.Context())
+	userID, _ := middleware.UserID(r.Context())
+
+	e, err := s.MFA.StepUp(r.Context(), domain.TenantID(tenantID), userID, req.ChallengeID)
+	if err != nil {
+		writeError(w, mapError(err))
+		return
+	}
+	ttl, err := s.tokenTTL(r.Context(), tenantID)
+	if err != nil {
+		writeError(w, mapError(err))
+		return
+	}
+	token, exp, err := s.Tokens.IssueElevated(r.Context(), tenantID, userID, e, ttl)
+	if err != nil {
+		writeError(w, &AppError{Status: 500, Code: "token_error", Message: "token_issue_failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, stepUpResponse{
+		AccessToken: token,
+		ExpiresAt:   exp.UTC().Format(time.RFC3339Nano),
+		ACR:         e.ACR,
+		AMR:         e.AMR,
+		AuthTime:    e.AuthTime.UTC().Format(time.RFC3339),
+		Action:      e.Action,
+	})
+}
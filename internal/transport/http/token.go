@@ -3,8 +3,14 @@ package httptransport
 import (
 	"context"
 	"time"
+
+	"trustpin_integration/internal/application"
 )
 
+// TokenIssuer issues the service's tokens. A zero ttl for an access token
+// means the issuer's default lifetime.
 type TokenIssuer interface {
-	Issue(ctx context.Context, tenantID, userID string) (string, time.Time, error)
+	Issue(ctx context.Context, tenantID, userID string, ttl time.Duration) (string, time.Time, error)
+	IssueElevated(ctx context.Context, tenantID, userID string, e *application.Elevation, ttl time.Duration) (string, time.Time, error)
+	IssuePreAuth(ctx context.Context, tenantID, userID, transactionID string) (string, time.Time, error)
 }
@@ -0,0 +1,70 @@
+package httptransport
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"trustpin_integration/internal/domain"
+	"trustpin_integration/internal/middleware"
+)
+
+type totpEnrollRequest struct {
+	DeviceID string `json:"device_id"`
+	Label    string `json:"label"`
+}
+
+type totpActivateRequest struct {
+	DeviceID string `json:"device_id"`
+	Code     string `json:"code"`
+}
+
+func (s *Server) handleEnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req totpEnrollRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "invalid_json"})
+		return
+	}
+	if req.DeviceID == "" {
+		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "missing_fields"})
+		return
+	}
+	tenantID, _ := middleware.TenantID(r.Context())
+	userID, _ := middleware.UserID(r.Context())
+
+	s.handleIdempotency(w, r, tenantID, func() (any, *AppError) {
+		res, err := s.MFA.EnrollTOTP(r.Context(), domain.TenantID(tenantID), userID, req.DeviceID, req.Label)
+		if err != nil {
+			return nil, mapError(err)
+		}
+		return res, nil
+	})
+}
+
+func (s *Server) handleActivateTOTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req totpActivateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "invalid_json"})
+		return
+	}
+	if req.DeviceID == "" || req.Code == "" {
+		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "missing_fields"})
+		return
+	}
+	tenantID, _ := middleware.TenantID(r.Context())
+	userID, _ := middleware.UserID(r.Context())
+
+	res, err := s.MFA.ActivateTOTP(r.Context(), domain.TenantID(tenantID), userID, req.DeviceID, req.Code)
+	if err != nil {
+		writeError(w, mapError(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,64 @@
+package httptransport
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"trustpin_integration/internal/application"
+)
+
+// maxWebhookBody bounds the webhook bodies read before the signature check.
+const maxWebhookBody = 64 << 10
+
+// handleTrustPinWebhook applies challenge results pushed by Trustpin. The
+// body must be signed with the shared webhook secret: X-Trustpin-Signature
+// carries the hex HMAC-SHA256 of the raw body, optionally prefixed "sha256=".
+func (s *Server) handleTrustPinWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "invalid_body"})
+		return
+	}
+	if !validWebhookSignature(s.WebhookSecret, body, r.Header.Get("X-Trustpin-Signature")) {
+		writeError(w, &AppError{Status: 401, Code: "unauthorized", Message: "invalid_signature"})
+		return
+	}
+	var req application.TrustPinChallengeResult
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "invalid_json"})
+		return
+	}
+	if req.TenantID == "" || req.ChallengeID == "" || req.Status == "" {
+		writeError(w, &AppError{Status: 400, Code: "bad_request", Message: "missing_fields"})
+		return
+	}
+	if err := s.MFA.ApplyChallengeResult(r.Context(), req); err != nil {
+		writeError(w, mapError(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validWebhookSignature reports whether sig is the HMAC of body under
+// secret. Without a secret no webhook is accepted.
+func validWebhookSignature(secret string, body []byte, sig string) bool {
+	if secret == "" {
+		return false
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(sig, "sha256="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
@@ -0,0 +1,53 @@
+-- Devices used to be duplicated on activation when Trustpin returned a device
+-- ID different from the one the client enrolled with: a second "alias" row was
+-- inserted under the Trustpin ID. The Trustpin ID is now an attribute of the
+-- original row, so fold every alias back into the device it was copied from.
+--
+-- An alias row shares tenant, user and created_at with its original and was
+-- written after it. Either row may have been revoked since, through its own
+-- ID; a revoked alias revokes the merged device.
+
+BEGIN;
+
+ALTER TABLE mfa_devices ADD COLUMN IF NOT EXISTS trustpin_device_id TEXT;
+
+CREATE TEMP TABLE device_aliases ON COMMIT DROP AS
+SELECT orig.tenant_id, orig.id AS device_id, alias.id AS alias_id, alias.state AS alias_state
+FROM mfa_devices orig
+JOIN mfa_devices alias
+  ON alias.tenant_id = orig.tenant_id
+ AND alias.user_id = orig.user_id
+ AND alias.created_at = orig.created_at
+ AND alias.id <> orig.id
+ AND alias.updated_at > orig.updated_at;
+
+UPDATE mfa_devices d
+SET trustpin_device_id = a.alias_id,
+    state = CASE WHEN a.alias_state = 'REVOKED' THEN 'REVOKED' ELSE d.state END
+FROM device_aliases a
+WHERE d.tenant_id = a.tenant_id AND d.id = a.device_id;
+
+UPDATE mfa_challenges c
+SET device_id = a.device_id
+FROM device_aliases a
+WHERE c.tenant_id = a.tenant_id AND c.device_id = a.alias_id;
+
+DELETE FROM mfa_devices d
+USING device_aliases a
+WHERE d.tenant_id = a.tenant_id AND d.id = a.alias_id;
+
+-- Devices activated without an alias already use their own ID at Trustpin.
+UPDATE mfa_devices d
+SET trustpin_device_id = d.id
+WHERE d.state = 'ACTIVE'
+  AND d.trustpin_device_id IS NULL
+  AND NOT EXISTS (
+      SELECT 1 FROM device_aliases a
+      WHERE a.tenant_id = d.tenant_id AND a.device_id = d.id
+  );
+
+CREATE UNIQUE INDEX IF NOT EXISTS mfa_devices_trustpin_device_id_key
+    ON mfa_devices (tenant_id, trustpin_device_id)
+    WHERE trustpin_device_id IS NOT NULL;
+
+COMMIT;
@@ -0,0 +1,28 @@
+-- Upstream (Trustpin) operations recorded in the same transaction as the
+-- local change that requires them, delivered by the outbox dispatcher.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS outbox_messages (
+    id              TEXT PRIMARY KEY,
+    tenant_id       TEXT NOT NULL,
+    operation       TEXT NOT NULL,
+    dedupe_key      TEXT NOT NULL,
+    payload         JSONB NOT NULL,
+    state           TEXT NOT NULL DEFAULT 'PENDING',
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_error      TEXT NOT NULL DEFAULT '',
+    result          JSONB,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (tenant_id, dedupe_key)
+);
+
+-- ClaimDue: SELECT ... WHERE state = 'PENDING' AND next_attempt_at <= now()
+-- ORDER BY next_attempt_at FOR UPDATE SKIP LOCKED.
+CREATE INDEX IF NOT EXISTS outbox_messages_due_idx
+    ON outbox_messages (next_attempt_at)
+    WHERE state = 'PENDING';
+
+COMMIT;
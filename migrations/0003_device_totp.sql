@@ -0,0 +1,9 @@
+-- Devices now have a type. Existing rows are all Trustpin devices; TOTP
+-- devices keep their shared secret, sealed with TOTP_ENCRYPTION_KEY.
+
+BEGIN;
+
+ALTER TABLE mfa_devices ADD COLUMN IF NOT EXISTS type TEXT NOT NULL DEFAULT 'TRUSTPIN';
+ALTER TABLE mfa_devices ADD COLUMN IF NOT EXISTS secret TEXT;
+
+COMMIT;
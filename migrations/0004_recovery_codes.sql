@@ -0,0 +1,28 @@
+-- Single-use recovery codes, stored as SHA-256 hashes. Regenerating a set
+-- deletes the previous one.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id         TEXT PRIMARY KEY,
+    tenant_id  TEXT NOT NULL,
+    user_id    TEXT NOT NULL,
+    code_hash  TEXT NOT NULL,
+    used_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (tenant_id, user_id, code_hash)
+);
+
+CREATE TABLE IF NOT EXISTS audit_logs (
+    id         TEXT PRIMARY KEY,
+    tenant_id  TEXT NOT NULL,
+    user_id    TEXT,
+    event_type TEXT NOT NULL,
+    payload    JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS audit_logs_tenant_created_idx
+    ON audit_logs (tenant_id, created_at);
+
+COMMIT;
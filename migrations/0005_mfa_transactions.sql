@@ -0,0 +1,17 @@
+-- Logins waiting for their second factor. A transaction completes once, when
+-- its challenge has been approved and the access token is issued.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS mfa_transactions (
+    id           TEXT PRIMARY KEY,
+    tenant_id    TEXT NOT NULL,
+    user_id      TEXT NOT NULL,
+    challenge_id TEXT NOT NULL,
+    state        TEXT NOT NULL DEFAULT 'PENDING',
+    expires_at   TIMESTAMPTZ NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+COMMIT;
@@ -0,0 +1,17 @@
+-- Audit entries record the request that caused them, and are queried per
+-- tenant by user, event type and time. Tenant roles decide who may read them.
+
+BEGIN;
+
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS request_id TEXT;
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS ip TEXT;
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS user_agent TEXT;
+
+CREATE INDEX IF NOT EXISTS audit_logs_tenant_user_created_idx
+    ON audit_logs (tenant_id, user_id, created_at);
+CREATE INDEX IF NOT EXISTS audit_logs_tenant_event_created_idx
+    ON audit_logs (tenant_id, event_type, created_at);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS roles TEXT[] NOT NULL DEFAULT '{}';
+
+COMMIT;
@@ -0,0 +1,23 @@
+-- Audit entries are hash-chained per tenant (seq, prev_hash, hash) and the
+-- chain heads are periodically signed. Entries written before this migration
+-- have no seq and are not part of any chain.
+
+BEGIN;
+
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS seq BIGINT;
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS prev_hash TEXT;
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS hash TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS audit_logs_tenant_seq_idx
+    ON audit_logs (tenant_id, seq);
+
+CREATE TABLE IF NOT EXISTS audit_checkpoints (
+    tenant_id  TEXT NOT NULL,
+    seq        BIGINT NOT NULL,
+    hash       TEXT NOT NULL,
+    signature  TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (tenant_id, seq)
+);
+
+COMMIT;
@@ -0,0 +1,11 @@
+-- Challenges record the risk evaluation they were created under: the summed
+-- score, the rules that fired and the decision (allow, push,
+-- push_number_match or deny).
+
+BEGIN;
+
+ALTER TABLE mfa_challenges ADD COLUMN IF NOT EXISTS risk_score INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE mfa_challenges ADD COLUMN IF NOT EXISTS risk_rules TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE mfa_challenges ADD COLUMN IF NOT EXISTS risk_decision TEXT NOT NULL DEFAULT 'push';
+
+COMMIT;
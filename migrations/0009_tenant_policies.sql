@@ -0,0 +1,21 @@
+-- One MFA policy per tenant. NULL and zero columns fall back to the service
+-- defaults; an empty array is an explicit "all".
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS tenant_policies (
+    tenant_id TEXT PRIMARY KEY,
+    mfa_actions TEXT[],
+    allowed_factors TEXT[],
+    max_devices_per_user INTEGER NOT NULL DEFAULT 0,
+    challenge_ttl INTERVAL,
+    nonce_ttl INTERVAL,
+    token_ttl INTERVAL,
+    idempotency_ttl INTERVAL,
+    max_consecutive_denials INTEGER NOT NULL DEFAULT 0,
+    lockout_base INTERVAL,
+    lockout_max INTERVAL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+COMMIT;
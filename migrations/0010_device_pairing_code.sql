@@ -0,0 +1,10 @@
+-- Devices waiting for pairing keep their Trustpin pairing code, sealed with
+-- TOTP_ENCRYPTION_KEY, so the pairing QR code can be rendered on request. The
+-- code is cleared once the device is activated.
+
+BEGIN;
+
+ALTER TABLE mfa_devices ADD COLUMN IF NOT EXISTS pairing_code TEXT;
+CREATE INDEX IF NOT EXISTS mfa_devices_trustpin_enroll_id_idx ON mfa_devices (tenant_id, trustpin_enroll_id);
+
+COMMIT;
@@ -0,0 +1,14 @@
+-- Challenges sent without a device fan out to the user's devices: each
+-- device gets its own challenge pointing at the logical one through
+-- parent_id. Users may pick one primary device to receive such challenges
+-- instead.
+
+BEGIN;
+
+ALTER TABLE mfa_challenges ADD COLUMN IF NOT EXISTS parent_id TEXT;
+CREATE INDEX IF NOT EXISTS mfa_challenges_parent_id_idx ON mfa_challenges (tenant_id, parent_id) WHERE parent_id IS NOT NULL;
+
+ALTER TABLE mfa_devices ADD COLUMN IF NOT EXISTS is_primary BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE UNIQUE INDEX IF NOT EXISTS mfa_devices_primary_idx ON mfa_devices (tenant_id, user_id) WHERE is_primary;
+
+COMMIT;
@@ -0,0 +1,19 @@
+-- Every state a challenge reaches is recorded with the time, the actor that
+-- moved it there (user, webhook, reconciler, sweeper or risk_engine) and the
+-- request ID or upstream idempotency key behind the change.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS mfa_challenge_transitions (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id TEXT NOT NULL,
+    challenge_id TEXT NOT NULL,
+    state TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    correlation_id TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS mfa_challenge_transitions_challenge_idx ON mfa_challenge_transitions (tenant_id, challenge_id, id);
+
+COMMIT;
@@ -0,0 +1,9 @@
+-- Transaction-signing challenges record the hash of the transaction the
+-- approval must commit to and the text the device displayed for it.
+
+BEGIN;
+
+ALTER TABLE mfa_challenges ADD COLUMN IF NOT EXISTS transaction_hash TEXT;
+ALTER TABLE mfa_challenges ADD COLUMN IF NOT EXISTS transaction_text TEXT;
+
+COMMIT;
@@ -0,0 +1,9 @@
+-- Quorum challenges need approval from several users. The logical
+-- challenge records how many approvals it needs; its per-device challenges
+-- belong to the approvers and point at it through parent_id.
+
+BEGIN;
+
+ALTER TABLE mfa_challenges ADD COLUMN IF NOT EXISTS quorum INTEGER NOT NULL DEFAULT 0;
+
+COMMIT;
@@ -0,0 +1,12 @@
+-- Devices record the factor provider they were enrolled with, and tenant
+-- policies order the providers each device type is routed to. Existing
+-- devices keep a NULL provider and are served by the tenant's provider for
+-- their type.
+
+BEGIN;
+
+ALTER TABLE mfa_devices ADD COLUMN IF NOT EXISTS provider TEXT;
+
+ALTER TABLE tenant_policies ADD COLUMN IF NOT EXISTS providers TEXT[];
+
+COMMIT;
@@ -0,0 +1,13 @@
+-- Outbox messages keep the request ID, W3C traceparent and deadline of the
+-- request that enqueued them, so deliveries to Trustpin carry them on.
+-- Messages from before have none of them.
+
+BEGIN;
+
+ALTER TABLE outbox_messages ADD COLUMN IF NOT EXISTS request_id TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE outbox_messages ADD COLUMN IF NOT EXISTS traceparent TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE outbox_messages ADD COLUMN IF NOT EXISTS deadline TIMESTAMPTZ;
+
+COMMIT;